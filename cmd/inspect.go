@@ -3,91 +3,189 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
-	"sort"
+	"slices"
+	"strings"
 
+	"github.com/riyasyash/pg_rocket/internal/config"
 	"github.com/riyasyash/pg_rocket/internal/db"
+	"github.com/riyasyash/pg_rocket/internal/graph"
 	"github.com/spf13/cobra"
 )
 
 var (
-	inspectSourceDSN string
+	inspectSourceDSN  string
+	inspectSchemaList string
+	inspectConfigFile string
+	inspectFormat     string
+	inspectOutFile    string
+	inspectTable      string
+	inspectDepth      int
+	inspectDirection  string
+	pathFrom          string
+	pathTo            string
+	pathLimit         int
+	pathMaxHops       int
+	pathFormat        string
 )
 
 var inspectCmd = &cobra.Command{
 	Use:   "inspect",
 	Short: "Display the foreign key graph of the database",
-	Long:  `Inspect shows the foreign key relationships in the connected database.`,
-	RunE:  runInspect,
+	Long: `Inspect shows the foreign key relationships in the connected database.
+The graph can be printed as text, Graphviz DOT, Mermaid or JSON.`,
+	RunE: runInspect,
+}
+
+var inspectPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Find foreign key paths between two tables",
+	Long: `Path lists the shortest chains of foreign keys connecting two tables,
+following references in either direction, with the columns joined at each hop.`,
+	RunE: runInspectPath,
 }
 
 func init() {
-	inspectCmd.Flags().StringVar(&inspectSourceDSN, "source", "", "Source database DSN (default: PGROCKET_SOURCE env var)")
+	inspectCmd.PersistentFlags().StringVar(&inspectSourceDSN, "source", "", "Source database DSN (default: PGROCKET_SOURCE env var)")
+	inspectCmd.PersistentFlags().StringVar(&inspectSchemaList, "schemas", "", "Comma-separated schemas to inspect (default: search_path)")
+	inspectCmd.PersistentFlags().StringVar(&inspectConfigFile, "config", "", "JSON config file (e.g. virtual foreign keys)")
+	inspectCmd.PersistentFlags().StringVar(&inspectOutFile, "out", "", "Output file (default: stdout)")
+	inspectCmd.Flags().StringVar(&inspectFormat, "format", graph.FormatText, "Output format: text, dot, mermaid or json")
+	inspectCmd.Flags().StringVar(&inspectTable, "table", "", "Only show tables around this table")
+	inspectCmd.Flags().IntVar(&inspectDepth, "depth", 2, "Maximum hops from --table (-1 for unlimited)")
+	inspectCmd.Flags().StringVar(&inspectDirection, "direction", graph.DirectionBoth, "Direction from --table: up (parents), down (children) or both")
+
+	inspectPathCmd.Flags().StringVar(&pathFrom, "from", "", "Table the paths start at (required)")
+	inspectPathCmd.Flags().StringVar(&pathTo, "to", "", "Table the paths end at (required)")
+	inspectPathCmd.Flags().IntVar(&pathLimit, "limit", 5, "Maximum number of paths, shortest first (0 for all)")
+	inspectPathCmd.Flags().IntVar(&pathMaxHops, "max-hops", 6, "Maximum number of foreign keys in a path")
+	inspectPathCmd.Flags().StringVar(&pathFormat, "format", graph.FormatText, "Output format: text or json")
+	inspectPathCmd.MarkFlagRequired("from")
+	inspectPathCmd.MarkFlagRequired("to")
+
+	inspectCmd.AddCommand(inspectPathCmd)
 }
 
 func runInspect(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
-	// Set source DSN with priority: --source flag > PGROCKET_SOURCE env
-	if inspectSourceDSN == "" {
-		inspectSourceDSN = os.Getenv("PGROCKET_SOURCE")
+	if !slices.Contains(graph.Formats, inspectFormat) {
+		return fmt.Errorf("invalid --format '%s'. Use one of: %s", inspectFormat, strings.Join(graph.Formats, ", "))
 	}
 
-	conn, err := db.NewConnection(ctx, inspectSourceDSN)
+	switch inspectDirection {
+	case graph.DirectionUp, graph.DirectionDown, graph.DirectionBoth:
+	default:
+		return fmt.Errorf("invalid --direction '%s'. Use up, down or both", inspectDirection)
+	}
+
+	metadata, g, err := loadInspectGraph(ctx)
 	if err != nil {
-		return fmt.Errorf("connection failed: %w", err)
+		return err
+	}
+
+	tables := g.RelatedTables()
+	if inspectTable != "" {
+		table, err := metadata.ResolveTable(inspectTable)
+		if err != nil {
+			return err
+		}
+		tables = g.Neighbourhood(table, inspectDepth, inspectDirection)
+	}
+
+	return writeInspectOutput(func(w io.Writer) error {
+		return g.Render(w, inspectFormat, tables)
+	})
+}
+
+func runInspectPath(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	if pathFormat != graph.FormatText && pathFormat != graph.FormatJSON {
+		return fmt.Errorf("invalid --format '%s'. Use text or json", pathFormat)
+	}
+
+	if pathMaxHops < 1 {
+		return fmt.Errorf("--max-hops must be at least 1")
+	}
+
+	if pathLimit < 0 {
+		return fmt.Errorf("--limit cannot be negative")
+	}
+
+	metadata, g, err := loadInspectGraph(ctx)
+	if err != nil {
+		return err
 	}
-	defer conn.Close()
 
-	metadata, err := conn.ExtractMetadata(ctx)
+	from, err := metadata.ResolveTable(pathFrom)
 	if err != nil {
-		return fmt.Errorf("failed to extract metadata: %w", err)
+		return err
 	}
 
-	allTables := make(map[string]bool)
-	for table := range metadata.Parents {
-		allTables[table] = true
+	to, err := metadata.ResolveTable(pathTo)
+	if err != nil {
+		return err
 	}
-	for table := range metadata.Children {
-		allTables[table] = true
+
+	if from == to {
+		return fmt.Errorf("--from and --to must be different tables")
 	}
 
-	tables := make([]string, 0, len(allTables))
-	for table := range allTables {
-		tables = append(tables, table)
+	paths := g.FindPaths(from, to, pathMaxHops, pathLimit)
+
+	return writeInspectOutput(func(w io.Writer) error {
+		return graph.RenderPaths(w, pathFormat, from, to, paths)
+	})
+}
+
+// loadInspectGraph connects to the source database and builds the FK graph
+// from its metadata, including virtual foreign keys from the config file.
+func loadInspectGraph(ctx context.Context) (*db.Metadata, *graph.Graph, error) {
+	// Set source DSN with priority: --source flag > PGROCKET_SOURCE env
+	if inspectSourceDSN == "" {
+		inspectSourceDSN = os.Getenv("PGROCKET_SOURCE")
 	}
-	sort.Strings(tables)
 
-	fmt.Println("Database Foreign Key Graph:")
-	fmt.Println()
+	cfg, err := config.Load(inspectConfigFile)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	for _, table := range tables {
-		fmt.Printf("%s\n", table)
+	conn, err := db.NewConnection(ctx, inspectSourceDSN)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connection failed: %w", err)
+	}
+	defer conn.Close()
 
-		parents := metadata.Parents[table]
-		if len(parents) > 0 {
-			sort.Slice(parents, func(i, j int) bool {
-				return parents[i].ParentTable < parents[j].ParentTable
-			})
+	metadata, err := conn.ExtractMetadata(ctx, &db.MetadataOptions{
+		Schemas:            splitList(inspectSchemaList),
+		VirtualForeignKeys: cfg.ForeignKeys(),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to extract metadata: %w", err)
+	}
 
-			for _, fk := range parents {
-				fmt.Printf("  ↑ %s (via %s)\n", fk.ParentTable, fk.ChildColumn)
-			}
-		}
+	g, err := graph.BuildGraph(metadata)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		children := metadata.Children[table]
-		if len(children) > 0 {
-			sort.Slice(children, func(i, j int) bool {
-				return children[i].ChildTable < children[j].ChildTable
-			})
+	return metadata, g, nil
+}
 
-			for _, fk := range children {
-				fmt.Printf("  ↓ %s (via %s.%s)\n", fk.ChildTable, fk.ChildTable, fk.ChildColumn)
-			}
-		}
+// writeInspectOutput runs write against the --out file, or stdout if none is given.
+func writeInspectOutput(write func(io.Writer) error) error {
+	if inspectOutFile == "" {
+		return write(os.Stdout)
+	}
 
-		fmt.Println()
+	file, err := os.Create(inspectOutFile)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
 	}
+	defer file.Close()
 
-	return nil
+	return write(file)
 }
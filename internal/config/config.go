@@ -0,0 +1,83 @@
+// Package config loads pg_rocket configuration files. A configuration file is
+// a JSON document that declares schema knowledge the database itself does not
+// hold, such as relationships that were never created as constraints.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+)
+
+// Config is the top-level structure of a pg_rocket configuration file.
+type Config struct {
+	VirtualForeignKeys []VirtualForeignKey `json:"virtual_foreign_keys"` // Relationships not declared in the database
+	Where              map[string]string   `json:"where"`                // Predicates applied when fetching child rows, by table
+}
+
+// VirtualForeignKey declares a relationship that is treated like a foreign key
+// constraint during extraction. Table names may be schema-qualified; unqualified
+// names are resolved against the selected schemas.
+type VirtualForeignKey struct {
+	Name          string   `json:"name,omitempty"` // Optional name shown by inspect
+	ChildTable    string   `json:"child_table"`
+	ChildColumns  []string `json:"child_columns"`
+	ParentTable   string   `json:"parent_table"`
+	ParentColumns []string `json:"parent_columns"`
+}
+
+// Load reads and parses the configuration file at path.
+// An empty path returns an empty configuration.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for i, vfk := range cfg.VirtualForeignKeys {
+		if vfk.ChildTable == "" || vfk.ParentTable == "" {
+			return nil, fmt.Errorf("virtual foreign key #%d: child_table and parent_table are required", i+1)
+		}
+		if len(vfk.ChildColumns) == 0 || len(vfk.ChildColumns) != len(vfk.ParentColumns) {
+			return nil, fmt.Errorf("virtual foreign key #%d (%s -> %s): child_columns and parent_columns must be non-empty and of equal length",
+				i+1, vfk.ChildTable, vfk.ParentTable)
+		}
+	}
+
+	for table, predicate := range cfg.Where {
+		if strings.TrimSpace(predicate) == "" {
+			return nil, fmt.Errorf("where: predicate for table %s is empty", table)
+		}
+	}
+
+	return cfg, nil
+}
+
+// ForeignKeys converts the declared virtual foreign keys to db.ForeignKey
+// values, marked as virtual. Table names are left as written in the file.
+func (c *Config) ForeignKeys() []db.ForeignKey {
+	fks := make([]db.ForeignKey, 0, len(c.VirtualForeignKeys))
+	for _, vfk := range c.VirtualForeignKeys {
+		fks = append(fks, db.ForeignKey{
+			Name:          vfk.Name,
+			ChildTable:    vfk.ChildTable,
+			ChildColumns:  vfk.ChildColumns,
+			ParentTable:   vfk.ParentTable,
+			ParentColumns: vfk.ParentColumns,
+			Virtual:       true,
+		})
+	}
+	return fks
+}
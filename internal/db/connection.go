@@ -11,6 +11,9 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// DefaultPoolSize is the number of pooled connections opened by NewConnection.
+const DefaultPoolSize = 5
+
 // Connection wraps a pgx connection pool for database operations.
 type Connection struct {
 	Pool *pgxpool.Pool
@@ -20,6 +23,12 @@ type Connection struct {
 // If dsn is empty, it falls back to the PGROCKET_SOURCE environment variable.
 // Returns an error if connection fails or no DSN is provided.
 func NewConnection(ctx context.Context, dsn string) (*Connection, error) {
+	return NewConnectionWithPoolSize(ctx, dsn, DefaultPoolSize)
+}
+
+// NewConnectionWithPoolSize is like NewConnection but pools up to poolSize
+// connections, e.g. to run fetch queries concurrently.
+func NewConnectionWithPoolSize(ctx context.Context, dsn string, poolSize int) (*Connection, error) {
 	if dsn == "" {
 		dsn = os.Getenv("PGROCKET_SOURCE")
 	}
@@ -32,7 +41,7 @@ func NewConnection(ctx context.Context, dsn string) (*Connection, error) {
 		return nil, fmt.Errorf("failed to parse DSN: %w", err)
 	}
 
-	config.MaxConns = 5
+	config.MaxConns = int32(poolSize)
 
 	pool, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
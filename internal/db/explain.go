@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+
+	"github.com/jackc/pgx/v5"
 )
 
 // ExplainPlan represents the top-level structure of PostgreSQL EXPLAIN JSON output.
@@ -15,121 +18,178 @@ type ExplainPlan struct {
 // ExplainNode represents a node in the EXPLAIN query plan tree.
 type ExplainNode struct {
 	NodeType     string        `json:"Node Type"`
+	Operation    string        `json:"Operation,omitempty"` // Insert, Update or Delete for ModifyTable nodes
 	RelationName string        `json:"Relation Name,omitempty"`
+	Schema       string        `json:"Schema,omitempty"`
+	PlanRows     float64       `json:"Plan Rows"`
 	Plans        []ExplainNode `json:"Plans,omitempty"`
 }
 
-// DetectBaseTable analyzes a SQL query using EXPLAIN to determine which table
-// it operates on. Returns an error if the query is not read-only, references
-// multiple tables, or cannot be analyzed.
-func (c *Connection) DetectBaseTable(ctx context.Context, query string) (string, error) {
-	query = strings.TrimSpace(query)
+// Subquery embeds query as a derived table named alias, for use in a FROM
+// clause. Root queries only ever run embedded this way, which parses only for
+// a single read query: data-modifying statements are rejected by the parser,
+// and further statements by pgx's extended protocol. A trailing semicolon is
+// dropped, and the closing parenthesis goes on its own line so that a trailing
+// line comment cannot swallow it.
+func Subquery(query, alias string) string {
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	return fmt.Sprintf("(%s\n) AS %s", query, alias)
+}
 
-	upperQuery := strings.ToUpper(query)
-	if strings.Contains(upperQuery, "INSERT") ||
-		strings.Contains(upperQuery, "UPDATE") ||
-		strings.Contains(upperQuery, "DELETE") ||
-		strings.Contains(upperQuery, "DROP") ||
-		strings.Contains(upperQuery, "CREATE") ||
-		strings.Contains(upperQuery, "ALTER") {
-		return "", fmt.Errorf("query must be read-only (SELECT only)")
+// readOnly runs fn in a READ ONLY transaction, which is rolled back afterwards.
+// Functions with side effects called by user-supplied SQL, such as nextval or
+// functions writing to tables, then fail instead of modifying the database.
+func (c *Connection) readOnly(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := c.Pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin read-only transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	explainQuery := fmt.Sprintf("EXPLAIN (FORMAT JSON) %s", query)
+	return fn(tx)
+}
 
-	var planJSON []byte
-	err := c.Pool.QueryRow(ctx, explainQuery).Scan(&planJSON)
+// QueryTables analyzes a SQL query using EXPLAIN to determine which tables it
+// scans, including tables read by joins and subqueries. The tables are returned
+// as schema-qualified names, sorted. args are bound to the query's $n
+// placeholders. Returns an error if the query is not a read-only query, scans
+// no table, or cannot be analyzed.
+func (c *Connection) QueryTables(ctx context.Context, query string, args ...any) ([]string, error) {
+	plan, err := c.explain(ctx, fmt.Sprintf("SELECT * FROM %s", Subquery(query, "root")), args...)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute EXPLAIN: %w", err)
+		return nil, err
 	}
 
-	var plans []ExplainPlan
-	if err := json.Unmarshal(planJSON, &plans); err != nil {
-		return "", fmt.Errorf("failed to parse EXPLAIN output: %w", err)
-	}
-
-	if len(plans) == 0 {
-		return "", fmt.Errorf("empty EXPLAIN output")
+	if err := checkReadOnlyPlan(plan); err != nil {
+		return nil, err
 	}
 
 	tables := make(map[string]bool)
-	extractTables(&plans[0].Plan, tables)
+	extractTables(plan, tables)
 
 	if len(tables) == 0 {
-		return "", fmt.Errorf("no base table detected in query")
+		return nil, fmt.Errorf("no base table detected in query")
 	}
 
-	if len(tables) > 1 {
-		tableList := make([]string, 0, len(tables))
-		for table := range tables {
-			tableList = append(tableList, table)
-		}
-		return "", fmt.Errorf("query references multiple base tables: %v. Please ensure your query returns rows from exactly one base table", tableList)
+	tableList := make([]string, 0, len(tables))
+	for table := range tables {
+		tableList = append(tableList, table)
 	}
+	sort.Strings(tableList)
 
-	for table := range tables {
-		return table, nil
+	return tableList, nil
+}
+
+// ValidatePredicate checks that predicate is a read-only boolean condition on
+// the rows of tableName, using the same checks as root queries. The predicate
+// may reference other tables through subqueries. Callers must first check that
+// its parentheses balance, or it could close the parenthesis it is wrapped in.
+func (c *Connection) ValidatePredicate(ctx context.Context, tableName, predicate string) error {
+	// EXPLAIN parses and plans the predicate without executing it
+	query := fmt.Sprintf("SELECT * FROM %s WHERE (%s\n)", QuoteTable(tableName), predicate)
+	plan, err := c.explain(ctx, query)
+	if err != nil {
+		return err
 	}
 
-	return "", fmt.Errorf("no base table found")
+	if err := checkReadOnlyPlan(plan); err != nil {
+		return fmt.Errorf("predicate must be read-only: %w", err)
+	}
+
+	return nil
 }
 
-// extractTables recursively walks the EXPLAIN plan tree to find all referenced tables.
-func extractTables(node *ExplainNode, tables map[string]bool) {
-	if node.RelationName != "" {
-		tables[node.RelationName] = true
+// checkReadOnlyPlan rejects plans that modify data or lock rows. Neither can
+// come from a derived table's SELECT except through row locking clauses (FOR
+// UPDATE/SHARE), which a READ ONLY transaction would reject only when the
+// query runs.
+func checkReadOnlyPlan(node *ExplainNode) error {
+	switch node.NodeType {
+	case "ModifyTable":
+		return fmt.Errorf("query must be read-only (SELECT only): it would %s rows", strings.ToLower(node.Operation))
+	case "LockRows":
+		return fmt.Errorf("query must be read-only (SELECT only): it locks rows with FOR UPDATE/SHARE")
 	}
 
 	for i := range node.Plans {
-		extractTables(&node.Plans[i], tables)
+		if err := checkReadOnlyPlan(&node.Plans[i]); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (c *Connection) ValidateQuery(ctx context.Context, query string, tableName string, metadata *Metadata) error {
-	pkColumns, exists := metadata.PrimaryKey[tableName]
-	if !exists || len(pkColumns) == 0 {
-		fmt.Printf("DEBUG: Table '%s' not found in metadata. Available tables: %v\n", tableName, getTableNames(metadata.PrimaryKey))
-		return fmt.Errorf("table '%s' does not have a primary key defined", tableName)
-	}
+// explain runs EXPLAIN on query without executing it, in a read-only
+// transaction, and returns the root node of its plan. VERBOSE plans include
+// the schema of each relation.
+func (c *Connection) explain(ctx context.Context, query string, args ...any) (*ExplainNode, error) {
+	explainQuery := fmt.Sprintf("EXPLAIN (FORMAT JSON, VERBOSE) %s", query)
 
-	testQuery := fmt.Sprintf("%s LIMIT 0", query)
-	rows, err := c.Pool.Query(ctx, testQuery)
+	var planJSON []byte
+	err := c.readOnly(ctx, func(tx pgx.Tx) error {
+		return tx.QueryRow(ctx, explainQuery, args...).Scan(&planJSON)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to validate query: %w", err)
+		return nil, fmt.Errorf("failed to execute EXPLAIN: %w", err)
 	}
-	defer rows.Close()
 
-	fieldDescriptions := rows.FieldDescriptions()
-	foundPKs := make(map[string]bool)
+	var plans []ExplainPlan
+	if err := json.Unmarshal(planJSON, &plans); err != nil {
+		return nil, fmt.Errorf("failed to parse EXPLAIN output: %w", err)
+	}
 
-	for _, fd := range fieldDescriptions {
-		colName := string(fd.Name)
-		for _, pkCol := range pkColumns {
-			if colName == pkCol {
-				foundPKs[pkCol] = true
-			}
-		}
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("empty EXPLAIN output")
 	}
 
-	// Check all PK columns are present
-	missingPKs := make([]string, 0)
-	for _, pkCol := range pkColumns {
-		if !foundPKs[pkCol] {
-			missingPKs = append(missingPKs, pkCol)
-		}
+	return &plans[0].Plan, nil
+}
+
+// extractTables recursively walks the EXPLAIN plan tree to find all referenced tables.
+// VERBOSE plans include the schema of each relation, which is used to qualify the name.
+func extractTables(node *ExplainNode, tables map[string]bool) {
+	if node.RelationName != "" {
+		tables[QualifiedName(node.Schema, node.RelationName)] = true
 	}
 
-	if len(missingPKs) > 0 {
-		return fmt.Errorf("query must include all primary key columns. Missing: %v", missingPKs)
+	for i := range node.Plans {
+		extractTables(&node.Plans[i], tables)
 	}
+}
 
-	return nil
+// QueryColumns returns the names of the columns returned by query, with args
+// bound to its placeholders, without fetching any rows.
+func (c *Connection) QueryColumns(ctx context.Context, query string, args ...any) ([]string, error) {
+	testQuery := fmt.Sprintf("SELECT * FROM %s LIMIT 0", Subquery(query, "root"))
+
+	columns := make([]string, 0)
+	err := c.readOnly(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, testQuery, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for _, fd := range rows.FieldDescriptions() {
+			columns = append(columns, string(fd.Name))
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return columns, nil
 }
 
-func getTableNames(pkMap map[string][]string) []string {
-	tables := make([]string, 0, len(pkMap))
-	for table := range pkMap {
-		tables = append(tables, table)
+// EstimateRows returns the planner's estimate of the number of rows returned
+// by query, with args bound to its placeholders, using EXPLAIN without
+// executing it.
+func (c *Connection) EstimateRows(ctx context.Context, query string, args ...any) (int64, error) {
+	plan, err := c.explain(ctx, query, args...)
+	if err != nil {
+		return 0, err
 	}
-	return tables
+
+	return int64(plan.PlanRows), nil
 }
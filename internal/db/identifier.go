@@ -0,0 +1,35 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// QualifiedName joins a schema and table name into the "schema.table" form
+// used as the table key throughout pg_rocket.
+func QualifiedName(schema, table string) string {
+	return schema + "." + table
+}
+
+// SplitQualifiedName splits a "schema.table" key into its schema and table parts.
+// Unqualified names are assumed to live in the public schema.
+func SplitQualifiedName(name string) (string, string) {
+	schema, table, found := strings.Cut(name, ".")
+	if !found {
+		return "public", name
+	}
+	return schema, table
+}
+
+// QuoteIdentifier quotes a single SQL identifier such as a column name.
+func QuoteIdentifier(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+// QuoteTable quotes a "schema.table" key as a fully qualified SQL identifier,
+// e.g. billing.invoices becomes "billing"."invoices".
+func QuoteTable(name string) string {
+	schema, table := SplitQualifiedName(name)
+	return pgx.Identifier{schema, table}.Sanitize()
+}
@@ -3,92 +3,339 @@ package db
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 )
 
-// ForeignKey represents a single foreign key relationship between two tables.
+// ForeignKey represents a single foreign key constraint between two tables.
+// Table names are schema-qualified ("schema.table"). Composite foreign keys
+// carry one entry per column pair: ChildColumns[i] references ParentColumns[i].
 type ForeignKey struct {
-	ChildTable   string // Table containing the foreign key
-	ChildColumn  string // Column in child table
-	ParentTable  string // Referenced parent table
-	ParentColumn string // Referenced column in parent table
+	Name          string   // Constraint name
+	ChildTable    string   // Table containing the foreign key
+	ChildColumns  []string // Columns in child table, in constraint order
+	ParentTable   string   // Referenced parent table
+	ParentColumns []string // Referenced columns in parent table, paired with ChildColumns
+	Virtual       bool     // Declared in configuration rather than as a database constraint
+	Deferrable    bool     // Constraint is DEFERRABLE and can be checked at commit time
+}
+
+// Column describes a single column of a table.
+type Column struct {
+	Name     string // Column name
+	DataType string // Formatted type name, e.g. "integer" or "jsonb"
+	NotNull  bool   // True if the column has a NOT NULL constraint
+}
+
+// IsJSON reports whether the column holds json or jsonb data.
+func (c Column) IsJSON() bool {
+	return c.DataType == "jsonb" || c.DataType == "json"
+}
+
+// MetadataOptions controls which parts of the database schema are extracted.
+type MetadataOptions struct {
+	Schemas            []string     // Schemas to extract (empty means the connection's search_path)
+	VirtualForeignKeys []ForeignKey // User-declared relationships merged into the FK graph
 }
 
 // Metadata contains the complete foreign key and primary key structure
-// of a PostgreSQL database schema.
+// of a PostgreSQL database schema. All tables are keyed by their
+// schema-qualified name ("schema.table").
 type Metadata struct {
+	Schemas    []string                // Schemas used to resolve unqualified table names, in order
+	AllSchemas []string                // Schemas plus those reached through cross-schema foreign keys
 	Parents    map[string][]ForeignKey // Parent relationships by child table
 	Children   map[string][]ForeignKey // Child relationships by parent table
 	PrimaryKey map[string][]string     // Primary key columns per table (supports composite PKs)
+	UniqueKeys map[string][][]string   // NOT NULL unique index columns per table, usable when there is no PK
+	Columns    map[string][]Column     // Columns per table in ordinal order
 }
 
-// ExtractMetadata queries the database to extract all foreign key relationships
-// and primary key definitions from the public schema.
-func (c *Connection) ExtractMetadata(ctx context.Context) (*Metadata, error) {
+// ExtractMetadata queries the database to extract all foreign key relationships,
+// primary key definitions and column information from the selected schemas.
+// If no schemas are given, the schemas on the connection's search_path are used.
+// Tables in other schemas that take part in a foreign key with a selected
+// schema are included as well, and so on transitively, so cross-schema
+// relationships are preserved.
+func (c *Connection) ExtractMetadata(ctx context.Context, opts *MetadataOptions) (*Metadata, error) {
 	metadata := &Metadata{
 		Parents:    make(map[string][]ForeignKey),
 		Children:   make(map[string][]ForeignKey),
 		PrimaryKey: make(map[string][]string), // Changed: now slice of strings
+		UniqueKeys: make(map[string][][]string),
+		Columns:    make(map[string][]Column),
+	}
+
+	if opts != nil && len(opts.Schemas) > 0 {
+		metadata.Schemas = opts.Schemas
+	} else {
+		if err := c.Pool.QueryRow(ctx, "SELECT current_schemas(false)").Scan(&metadata.Schemas); err != nil {
+			return nil, fmt.Errorf("failed to read search_path: %w", err)
+		}
+	}
+
+	if len(metadata.Schemas) == 0 {
+		return nil, fmt.Errorf("no schemas to extract. Use --schemas or set a search_path")
+	}
+
+	var virtualFKs []ForeignKey
+	if opts != nil {
+		virtualFKs = opts.VirtualForeignKeys
+	}
+
+	// Extract foreign keys FIRST so that schemas referenced across
+	// schema boundaries can be included in the key and column lookups
+	err := metadata.collectForeignKeys(virtualFKs, func(schemas, known []string) ([]ForeignKey, error) {
+		return c.extractForeignKeys(ctx, schemas, known)
+	})
+	if err != nil {
+		return nil, err
+	}
+	schemas := metadata.AllSchemas
+
+	if err := c.extractPrimaryKeys(ctx, metadata, schemas); err != nil {
+		return nil, err
+	}
+
+	if err := c.extractUniqueKeys(ctx, metadata, schemas); err != nil {
+		return nil, err
 	}
 
-	// Extract primary keys FIRST (for all tables)
-	if err := c.extractPrimaryKeys(ctx, metadata); err != nil {
+	if err := c.extractColumns(ctx, metadata, schemas); err != nil {
 		return nil, err
 	}
 
-	// Then extract foreign keys
-	if err := c.extractForeignKeys(ctx, metadata); err != nil {
+	if err := metadata.mergeVirtualForeignKeys(virtualFKs); err != nil {
 		return nil, err
 	}
 
-	// Validation is no longer needed since we have all PKs
-	// Tables with FKs will automatically be validated
+	// Tables without a primary key fall back to a unique key or whole-row
+	// identity (see RowKey), so no key validation is needed here
 
 	return metadata, nil
 }
 
-func (c *Connection) extractForeignKeys(ctx context.Context, metadata *Metadata) error {
+// RowKey returns the columns that identify a row of the given table: the
+// primary key if there is one, otherwise the first NOT NULL unique key.
+// It returns nil for tables without any usable key, whose rows are then
+// identified by all of their column values.
+func (m *Metadata) RowKey(table string) []string {
+	if pks := m.PrimaryKey[table]; len(pks) > 0 {
+		return pks
+	}
+	if uniques := m.UniqueKeys[table]; len(uniques) > 0 {
+		return uniques[0]
+	}
+	return nil
+}
+
+// ResolveTable maps a table name given by the user to its schema-qualified key.
+// Qualified names are returned as-is if the table exists; unqualified names are
+// looked up in each schema of the search order in turn.
+func (m *Metadata) ResolveTable(name string) (string, error) {
+	if strings.Contains(name, ".") {
+		if _, exists := m.Columns[name]; exists {
+			return name, nil
+		}
+		return "", fmt.Errorf("table '%s' not found", name)
+	}
+
+	for _, schema := range m.Schemas {
+		qualified := QualifiedName(schema, name)
+		if _, exists := m.Columns[qualified]; exists {
+			return qualified, nil
+		}
+	}
+
+	return "", fmt.Errorf("table '%s' not found in schemas %v", name, m.Schemas)
+}
+
+// referencedSchemas returns the selected schemas plus every schema that
+// appears on either side of an extracted foreign key or, for qualified
+// names, of a virtual foreign key.
+func (m *Metadata) referencedSchemas(virtualFKs []ForeignKey) []string {
+	seen := make(map[string]bool)
+	for _, schema := range m.Schemas {
+		seen[schema] = true
+	}
+
+	extra := make([]string, 0)
+	addSchemaOf := func(table string) {
+		if !strings.Contains(table, ".") {
+			return
+		}
+		schema, _ := SplitQualifiedName(table)
+		if !seen[schema] {
+			seen[schema] = true
+			extra = append(extra, schema)
+		}
+	}
+
+	for _, fks := range m.Parents {
+		for _, fk := range fks {
+			addSchemaOf(fk.ChildTable)
+			addSchemaOf(fk.ParentTable)
+		}
+	}
+	for _, fk := range virtualFKs {
+		addSchemaOf(fk.ChildTable)
+		addSchemaOf(fk.ParentTable)
+	}
+	sort.Strings(extra)
+
+	schemas := make([]string, 0, len(m.Schemas)+len(extra))
+	schemas = append(schemas, m.Schemas...)
+	return append(schemas, extra...)
+}
+
+// collectForeignKeys adds the foreign keys returned by fetch for the selected
+// schemas, then for the schemas those keys and virtualFKs reach, until no new
+// schema is reached, and sets AllSchemas to the schemas reached. fetch returns
+// the foreign keys with either table in schemas and neither in known, the
+// schemas fetched before.
+func (m *Metadata) collectForeignKeys(virtualFKs []ForeignKey, fetch func(schemas, known []string) ([]ForeignKey, error)) error {
+	known := make([]string, 0)
+	fetched := make(map[string]bool)
+	pending := m.Schemas
+
+	for len(pending) > 0 {
+		fks, err := fetch(pending, known)
+		if err != nil {
+			return err
+		}
+		for _, fk := range fks {
+			m.Parents[fk.ChildTable] = append(m.Parents[fk.ChildTable], fk)
+			m.Children[fk.ParentTable] = append(m.Children[fk.ParentTable], fk)
+		}
+
+		for _, schema := range pending {
+			fetched[schema] = true
+		}
+		known = append(known, pending...)
+
+		m.AllSchemas = m.referencedSchemas(virtualFKs)
+		pending = make([]string, 0)
+		for _, schema := range m.AllSchemas {
+			if !fetched[schema] {
+				pending = append(pending, schema)
+			}
+		}
+	}
+
+	return nil
+}
+
+// mergeVirtualForeignKeys resolves the tables of user-declared foreign keys,
+// checks that their columns exist and adds them to Parents and Children so
+// that they are treated like real constraints.
+func (m *Metadata) mergeVirtualForeignKeys(virtualFKs []ForeignKey) error {
+	for _, fk := range virtualFKs {
+		childTable, err := m.ResolveTable(fk.ChildTable)
+		if err != nil {
+			return fmt.Errorf("virtual foreign key %s -> %s: %w", fk.ChildTable, fk.ParentTable, err)
+		}
+		parentTable, err := m.ResolveTable(fk.ParentTable)
+		if err != nil {
+			return fmt.Errorf("virtual foreign key %s -> %s: %w", fk.ChildTable, fk.ParentTable, err)
+		}
+
+		if err := m.checkColumns(childTable, fk.ChildColumns); err != nil {
+			return fmt.Errorf("virtual foreign key %s -> %s: %w", childTable, parentTable, err)
+		}
+		if err := m.checkColumns(parentTable, fk.ParentColumns); err != nil {
+			return fmt.Errorf("virtual foreign key %s -> %s: %w", childTable, parentTable, err)
+		}
+
+		fk.ChildTable = childTable
+		fk.ParentTable = parentTable
+		fk.Virtual = true
+		if fk.Name == "" {
+			_, relName := SplitQualifiedName(childTable)
+			fk.Name = fmt.Sprintf("%s_%s_vfkey", relName, strings.Join(fk.ChildColumns, "_"))
+		}
+
+		m.Parents[childTable] = append(m.Parents[childTable], fk)
+		m.Children[parentTable] = append(m.Children[parentTable], fk)
+	}
+
+	return nil
+}
+
+// checkColumns returns an error if any of the columns does not exist in table.
+func (m *Metadata) checkColumns(table string, columns []string) error {
+	known := make(map[string]bool)
+	for _, col := range m.Columns[table] {
+		known[col.Name] = true
+	}
+
+	for _, col := range columns {
+		if !known[col] {
+			return fmt.Errorf("column '%s' not found in table %s", col, table)
+		}
+	}
+
+	return nil
+}
+
+// extractForeignKeys returns the foreign keys with a table in schemas and none
+// in known.
+func (c *Connection) extractForeignKeys(ctx context.Context, schemas, known []string) ([]ForeignKey, error) {
 	// Use pg_catalog for better compatibility with restricted permissions
+	// Column pairs are unnested together so that composite constraints keep
+	// their column order and pairing instead of producing a cross product
 	query := `
 		SELECT
+			con.conname AS constraint_name,
+			n.nspname AS child_schema,
 			c.relname AS child_table,
-			a.attname AS child_column,
+			array_agg(a.attname::text ORDER BY k.ord) AS child_columns,
+			np.nspname AS parent_schema,
 			cp.relname AS parent_table,
-			ap.attname AS parent_column
+			array_agg(ap.attname::text ORDER BY k.ord) AS parent_columns,
+			con.condeferrable AS deferrable
 		FROM pg_constraint con
 		JOIN pg_class c ON con.conrelid = c.oid
 		JOIN pg_namespace n ON n.oid = c.relnamespace
-		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = ANY(con.conkey)
 		JOIN pg_class cp ON con.confrelid = cp.oid
-		JOIN pg_attribute ap ON ap.attrelid = cp.oid AND ap.attnum = ANY(con.confkey)
+		JOIN pg_namespace np ON np.oid = cp.relnamespace
+		CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(child_attnum, parent_attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = k.child_attnum
+		JOIN pg_attribute ap ON ap.attrelid = cp.oid AND ap.attnum = k.parent_attnum
 		WHERE con.contype = 'f'
-			AND n.nspname = 'public'
-		ORDER BY c.relname, a.attname
+			AND (n.nspname = ANY($1) OR np.nspname = ANY($1))
+			AND NOT (n.nspname = ANY($2) OR np.nspname = ANY($2))
+		GROUP BY con.oid, con.conname, n.nspname, c.relname, np.nspname, cp.relname, con.condeferrable
+		ORDER BY n.nspname, c.relname, con.conname
 	`
 
-	rows, err := c.Pool.Query(ctx, query)
+	rows, err := c.Pool.Query(ctx, query, schemas, known)
 	if err != nil {
-		return fmt.Errorf("failed to query foreign keys: %w", err)
+		return nil, fmt.Errorf("failed to query foreign keys: %w", err)
 	}
 	defer rows.Close()
 
+	fks := make([]ForeignKey, 0)
 	for rows.Next() {
 		var fk ForeignKey
-		if err := rows.Scan(&fk.ChildTable, &fk.ChildColumn, &fk.ParentTable, &fk.ParentColumn); err != nil {
-			return fmt.Errorf("failed to scan foreign key: %w", err)
+		var childSchema, parentSchema string
+		if err := rows.Scan(&fk.Name, &childSchema, &fk.ChildTable, &fk.ChildColumns, &parentSchema, &fk.ParentTable, &fk.ParentColumns, &fk.Deferrable); err != nil {
+			return nil, fmt.Errorf("failed to scan foreign key: %w", err)
 		}
 
-		metadata.Parents[fk.ChildTable] = append(metadata.Parents[fk.ChildTable], fk)
-		metadata.Children[fk.ParentTable] = append(metadata.Children[fk.ParentTable], fk)
+		fk.ChildTable = QualifiedName(childSchema, fk.ChildTable)
+		fk.ParentTable = QualifiedName(parentSchema, fk.ParentTable)
+		fks = append(fks, fk)
 	}
 
-	return rows.Err()
+	return fks, rows.Err()
 }
 
-func (c *Connection) extractPrimaryKeys(ctx context.Context, metadata *Metadata) error {
+func (c *Connection) extractPrimaryKeys(ctx context.Context, metadata *Metadata, schemas []string) error {
 	// Use pg_catalog instead of information_schema for better compatibility
 	// with restricted permissions
 	query := `
-		SELECT 
+		SELECT
+			n.nspname as table_schema,
 			c.relname as table_name,
 			a.attname as column_name,
 			a.attnum as ordinal_position
@@ -97,11 +344,11 @@ func (c *Connection) extractPrimaryKeys(ctx context.Context, metadata *Metadata)
 		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = ANY(con.conkey)
 		JOIN pg_namespace n ON n.oid = c.relnamespace
 		WHERE con.contype = 'p'
-			AND n.nspname = 'public'
-		ORDER BY c.relname, a.attnum
+			AND n.nspname = ANY($1)
+		ORDER BY n.nspname, c.relname, a.attnum
 	`
 
-	rows, err := c.Pool.Query(ctx, query)
+	rows, err := c.Pool.Query(ctx, query, schemas)
 	if err != nil {
 		return fmt.Errorf("failed to query primary keys: %w", err)
 	}
@@ -111,12 +358,14 @@ func (c *Connection) extractPrimaryKeys(ctx context.Context, metadata *Metadata)
 	tableCount := 0
 
 	for rows.Next() {
-		var tableName, columnName string
+		var schemaName, tableName, columnName string
 		var ordinalPosition int
-		if err := rows.Scan(&tableName, &columnName, &ordinalPosition); err != nil {
+		if err := rows.Scan(&schemaName, &tableName, &columnName, &ordinalPosition); err != nil {
 			return fmt.Errorf("failed to scan primary key: %w", err)
 		}
 
+		tableName = QualifiedName(schemaName, tableName)
+
 		// Add column to the PK slice for this table (supports composite PKs)
 		if _, exists := metadata.PrimaryKey[tableName]; !exists {
 			metadata.PrimaryKey[tableName] = make([]string, 0)
@@ -131,22 +380,86 @@ func (c *Connection) extractPrimaryKeys(ctx context.Context, metadata *Metadata)
 	return rows.Err()
 }
 
-// validatePrimaryKeys now only validates tables that are involved in FK relationships
-func (c *Connection) validatePrimaryKeys(metadata *Metadata) error {
-	allTables := make(map[string]bool)
+// extractUniqueKeys finds unique indexes that can stand in for a primary key:
+// non-partial, without expressions and covering only NOT NULL columns.
+// Keys are ordered by width and then index name so the narrowest one is preferred.
+func (c *Connection) extractUniqueKeys(ctx context.Context, metadata *Metadata, schemas []string) error {
+	query := `
+		SELECT
+			n.nspname AS table_schema,
+			c.relname AS table_name,
+			array_agg(a.attname::text ORDER BY k.ord) AS columns
+		FROM pg_index i
+		JOIN pg_class c ON i.indrelid = c.oid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_class ic ON i.indexrelid = ic.oid
+		CROSS JOIN LATERAL unnest(i.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = k.attnum
+		WHERE i.indisunique
+			AND NOT i.indisprimary
+			AND i.indpred IS NULL
+			AND i.indexprs IS NULL
+			AND k.ord <= i.indnkeyatts
+			AND n.nspname = ANY($1)
+		GROUP BY n.nspname, c.relname, ic.relname
+		HAVING bool_and(a.attnotnull)
+		ORDER BY n.nspname, c.relname, count(*), ic.relname
+	`
 
-	for table := range metadata.Parents {
-		allTables[table] = true
+	rows, err := c.Pool.Query(ctx, query, schemas)
+	if err != nil {
+		return fmt.Errorf("failed to query unique keys: %w", err)
 	}
-	for table := range metadata.Children {
-		allTables[table] = true
+	defer rows.Close()
+
+	for rows.Next() {
+		var schemaName, tableName string
+		var columns []string
+		if err := rows.Scan(&schemaName, &tableName, &columns); err != nil {
+			return fmt.Errorf("failed to scan unique key: %w", err)
+		}
+
+		tableName = QualifiedName(schemaName, tableName)
+		metadata.UniqueKeys[tableName] = append(metadata.UniqueKeys[tableName], columns)
 	}
 
-	for table := range allTables {
-		if pks, exists := metadata.PrimaryKey[table]; !exists || len(pks) == 0 {
-			return fmt.Errorf("table '%s' does not have a primary key. pg_rocket requires all tables to have a primary key", table)
+	return rows.Err()
+}
+
+func (c *Connection) extractColumns(ctx context.Context, metadata *Metadata, schemas []string) error {
+	query := `
+		SELECT
+			n.nspname AS table_schema,
+			c.relname AS table_name,
+			a.attname AS column_name,
+			format_type(a.atttypid, a.atttypmod) AS data_type,
+			a.attnotnull AS not_null
+		FROM pg_attribute a
+		JOIN pg_class c ON a.attrelid = c.oid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p')
+			AND a.attnum > 0
+			AND NOT a.attisdropped
+			AND n.nspname = ANY($1)
+		ORDER BY n.nspname, c.relname, a.attnum
+	`
+
+	rows, err := c.Pool.Query(ctx, query, schemas)
+	if err != nil {
+		return fmt.Errorf("failed to query columns: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schemaName, tableName string
+		var col Column
+		if err := rows.Scan(&schemaName, &tableName, &col.Name, &col.DataType, &col.NotNull); err != nil {
+			return fmt.Errorf("failed to scan column: %w", err)
 		}
+
+		tableName = QualifiedName(schemaName, tableName)
+		metadata.Columns[tableName] = append(metadata.Columns[tableName], col)
 	}
 
-	return nil
+	return rows.Err()
 }
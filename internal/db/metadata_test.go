@@ -0,0 +1,97 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+// fakeCatalog returns a fetch function for collectForeignKeys serving fks the
+// way extractForeignKeys does, and records the schemas of each call.
+func fakeCatalog(fks []ForeignKey, calls *[][]string) func(schemas, known []string) ([]ForeignKey, error) {
+	in := func(table string, schemas []string) bool {
+		schema, _ := SplitQualifiedName(table)
+		for _, s := range schemas {
+			if s == schema {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(schemas, known []string) ([]ForeignKey, error) {
+		*calls = append(*calls, schemas)
+		matched := make([]ForeignKey, 0)
+		for _, fk := range fks {
+			if (in(fk.ChildTable, schemas) || in(fk.ParentTable, schemas)) &&
+				!in(fk.ChildTable, known) && !in(fk.ParentTable, known) {
+				matched = append(matched, fk)
+			}
+		}
+		return matched, nil
+	}
+}
+
+func TestCollectForeignKeysFollowsSchemaChain(t *testing.T) {
+	fks := []ForeignKey{
+		{Name: "orders_account_id_fkey", ChildTable: "sales.orders", ParentTable: "billing.accounts"},
+		{Name: "accounts_owner_id_fkey", ChildTable: "billing.accounts", ParentTable: "auth.users"},
+		{Name: "events_host_id_fkey", ChildTable: "audit.events", ParentTable: "ops.hosts"},
+		{Name: "events_user_id_fkey", ChildTable: "audit.events", ParentTable: "auth.users"},
+		{Name: "hosts_site_id_fkey", ChildTable: "ops.hosts", ParentTable: "unrelated.sites"},
+		{Name: "a_b_fkey", ChildTable: "other.a", ParentTable: "other.b"},
+	}
+	m := &Metadata{
+		Schemas:  []string{"sales"},
+		Parents:  make(map[string][]ForeignKey),
+		Children: make(map[string][]ForeignKey),
+	}
+
+	var calls [][]string
+	if err := m.collectForeignKeys(nil, fakeCatalog(fks, &calls)); err != nil {
+		t.Fatal(err)
+	}
+
+	wantCalls := [][]string{{"sales"}, {"billing"}, {"auth"}, {"audit"}, {"ops"}, {"unrelated"}}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("fetched schemas %v, want %v", calls, wantCalls)
+	}
+
+	wantSchemas := []string{"sales", "audit", "auth", "billing", "ops", "unrelated"}
+	if !reflect.DeepEqual(m.AllSchemas, wantSchemas) {
+		t.Errorf("AllSchemas = %v, want %v", m.AllSchemas, wantSchemas)
+	}
+
+	wantParents := map[string]int{"sales.orders": 1, "billing.accounts": 1, "audit.events": 2, "ops.hosts": 1}
+	for table, n := range wantParents {
+		if len(m.Parents[table]) != n {
+			t.Errorf("Parents[%s] = %v, want %d foreign keys", table, m.Parents[table], n)
+		}
+	}
+	if len(m.Parents["other.a"]) != 0 {
+		t.Errorf("Parents[other.a] = %v, want none from an unreachable schema", m.Parents["other.a"])
+	}
+}
+
+func TestCollectForeignKeysFollowsVirtualForeignKeys(t *testing.T) {
+	fks := []ForeignKey{
+		{Name: "users_org_id_fkey", ChildTable: "auth.users", ParentTable: "auth.orgs"},
+	}
+	virtualFKs := []ForeignKey{{ChildTable: "orders", ParentTable: "auth.users"}}
+	m := &Metadata{
+		Schemas:  []string{"public"},
+		Parents:  make(map[string][]ForeignKey),
+		Children: make(map[string][]ForeignKey),
+	}
+
+	var calls [][]string
+	if err := m.collectForeignKeys(virtualFKs, fakeCatalog(fks, &calls)); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := [][]string{{"public"}, {"auth"}}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("fetched schemas %v, want %v", calls, want)
+	}
+	if len(m.Parents["auth.users"]) != 1 {
+		t.Errorf("Parents[auth.users] = %v, want the users_org_id_fkey", m.Parents["auth.users"])
+	}
+}
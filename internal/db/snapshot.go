@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Querier runs SQL queries. *pgxpool.Pool, pgx.Tx and *Snapshot satisfy it,
+// so the same code can query through the pool or inside a transaction.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// snapshotTxOptions are the options of every snapshot transaction.
+var snapshotTxOptions = pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+
+// Snapshot is a REPEATABLE READ READ ONLY transaction on one pooled connection.
+// Every query run through it, or through a transaction from Share, sees the
+// database as of the snapshot's first query, so rows fetched at different times
+// are consistent with each other.
+type Snapshot struct {
+	conn   *Connection
+	tx     pgx.Tx
+	id     string   // Exported snapshot ID, set by the first Share
+	shared []pgx.Tx // Transactions importing the snapshot
+}
+
+// BeginSnapshot starts a REPEATABLE READ READ ONLY transaction. The caller
+// must Close the snapshot to release its connections.
+func (c *Connection) BeginSnapshot(ctx context.Context) (*Snapshot, error) {
+	tx, err := c.Pool.BeginTx(ctx, snapshotTxOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin snapshot transaction: %w", err)
+	}
+
+	return &Snapshot{conn: c, tx: tx}, nil
+}
+
+// Query runs a query inside the snapshot transaction. Like pgx.Tx, a Snapshot
+// must not be used by several goroutines at once; use Share for that.
+func (s *Snapshot) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return s.tx.Query(ctx, sql, args...)
+}
+
+// Share starts a transaction on another pooled connection that imports the
+// snapshot with pg_export_snapshot/SET TRANSACTION SNAPSHOT, for use by another
+// goroutine. It is closed together with the snapshot.
+func (s *Snapshot) Share(ctx context.Context) (Querier, error) {
+	if s.id == "" {
+		if err := s.tx.QueryRow(ctx, "SELECT pg_export_snapshot()").Scan(&s.id); err != nil {
+			return nil, fmt.Errorf("failed to export snapshot: %w", err)
+		}
+	}
+
+	tx, err := s.conn.Pool.BeginTx(ctx, snapshotTxOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin shared snapshot transaction: %w", err)
+	}
+
+	// SET TRANSACTION does not accept parameters; the ID comes from the server
+	if _, err := tx.Exec(ctx, fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", s.id)); err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf("failed to import snapshot %s: %w", s.id, err)
+	}
+
+	s.shared = append(s.shared, tx)
+	return tx, nil
+}
+
+// Close ends the snapshot transaction and all transactions sharing it. Nothing
+// was written, so they are rolled back.
+func (s *Snapshot) Close(ctx context.Context) {
+	for _, tx := range s.shared {
+		tx.Rollback(ctx)
+	}
+	s.tx.Rollback(ctx)
+}
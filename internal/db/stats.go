@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// TableRowEstimates returns the planner's row count estimate (pg_class.reltuples)
+// of every table in the given schemas, keyed by schema-qualified name. Tables
+// that have never been vacuumed or analyzed are reported as -1.
+func (c *Connection) TableRowEstimates(ctx context.Context, schemas []string) (map[string]int64, error) {
+	query := `
+		SELECT
+			n.nspname as table_schema,
+			c.relname as table_name,
+			c.reltuples::bigint as row_estimate
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p')
+			AND n.nspname = ANY($1)
+	`
+
+	rows, err := c.Pool.Query(ctx, query, schemas)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table statistics: %w", err)
+	}
+	defer rows.Close()
+
+	estimates := make(map[string]int64)
+	for rows.Next() {
+		var schemaName, tableName string
+		var estimate int64
+		if err := rows.Scan(&schemaName, &tableName, &estimate); err != nil {
+			return nil, fmt.Errorf("failed to scan table statistics: %w", err)
+		}
+
+		// PostgreSQL 14+ reports -1 for tables without statistics; older
+		// versions report 0, which is indistinguishable from an empty table
+		if estimate < 0 {
+			estimate = -1
+		}
+		estimates[QualifiedName(schemaName, tableName)] = estimate
+	}
+
+	return estimates, rows.Err()
+}
@@ -3,6 +3,7 @@ package extractor
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/riyasyash/pg_rocket/internal/db"
 	"github.com/riyasyash/pg_rocket/internal/graph"
@@ -17,10 +18,10 @@ type Engine struct {
 }
 
 // NewEngine creates a new extraction engine by connecting to the database
-// and extracting schema metadata. Returns an error if connection or
-// metadata extraction fails.
-func NewEngine(ctx context.Context, conn *db.Connection) (*Engine, error) {
-	metadata, err := conn.ExtractMetadata(ctx)
+// and extracting schema metadata for the schemas selected in metaOpts.
+// Returns an error if connection or metadata extraction fails.
+func NewEngine(ctx context.Context, conn *db.Connection, metaOpts *db.MetadataOptions) (*Engine, error) {
+	metadata, err := conn.ExtractMetadata(ctx, metaOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract metadata: %w", err)
 	}
@@ -37,19 +38,154 @@ func NewEngine(ctx context.Context, conn *db.Connection) (*Engine, error) {
 	}, nil
 }
 
-// Extract performs data extraction starting from the given SQL query.
-// It validates the query, performs FK traversal based on the provided options,
-// and returns the traversal state containing all extracted data.
-func (e *Engine) Extract(ctx context.Context, query string, opts *TraversalOptions) (*TraversalState, error) {
-	queryInfo, err := ValidateQuery(ctx, e.Connection, query, e.Metadata)
+// Extract performs data extraction starting from the given SQL queries.
+// It validates the queries, performs FK traversal from all of their rows based
+// on the provided options, and returns the traversal state containing all
+// extracted data. Rows reached from several roots are extracted once.
+func (e *Engine) Extract(ctx context.Context, queries []string, opts *TraversalOptions) (*TraversalState, error) {
+	roots, err := e.prepare(ctx, queries, opts)
 	if err != nil {
-		return nil, fmt.Errorf("query validation failed: %w", err)
+		return nil, err
 	}
 
-	state := NewTraversalState(e.Graph, e.Connection, opts)
-	if err := state.Extract(ctx, queryInfo); err != nil {
+	state, err := NewTraversalState(e.Graph, e.Connection, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := state.Extract(ctx, roots); err != nil {
+		state.Close()
 		return nil, fmt.Errorf("extraction failed: %w", err)
 	}
 
 	return state, nil
 }
+
+// prepare validates the root queries and resolves the table names in opts.
+func (e *Engine) prepare(ctx context.Context, queries []string, opts *TraversalOptions) ([]*QueryInfo, error) {
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no root query given")
+	}
+
+	for i, table := range opts.SeedTables {
+		resolved, err := e.Metadata.ResolveTable(table)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --seed-table: %w", err)
+		}
+		opts.SeedTables[i] = resolved
+	}
+
+	roots := make([]*QueryInfo, 0, len(queries))
+	rootTables := make(map[string]bool)
+	for i, query := range queries {
+		queryInfo, err := ValidateQuery(ctx, e.Connection, query, opts.Params, e.Metadata, opts.SeedTables)
+		if err != nil {
+			if len(queries) > 1 {
+				return nil, fmt.Errorf("query %d validation failed: %w", i+1, err)
+			}
+			return nil, fmt.Errorf("query validation failed: %w", err)
+		}
+		roots = append(roots, queryInfo)
+		for _, table := range queryInfo.Tables() {
+			rootTables[table] = true
+		}
+	}
+
+	// Resolve user-supplied child table names against the schema search order
+	for i, child := range opts.SelectedChildren {
+		resolved, err := e.Metadata.ResolveTable(child)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --children table: %w", err)
+		}
+		opts.SelectedChildren[i] = resolved
+	}
+
+	tableLimits := make(map[string]int)
+	for table, limit := range opts.TableLimits {
+		resolved, err := e.Metadata.ResolveTable(table)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --table-limit table: %w", err)
+		}
+		tableLimits[resolved] = limit
+	}
+	opts.TableLimits = tableLimits
+
+	childLimits := make(map[string]ChildLimit)
+	for table, limit := range opts.ChildLimits {
+		resolved, err := e.Metadata.ResolveTable(table)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --child-limit table: %w", err)
+		}
+		terms := make([]string, 0, len(limit.OrderBy))
+		for _, term := range limit.OrderBy {
+			quoted, err := orderTerm(e.Graph, resolved, term)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --child-limit order: %w", err)
+			}
+			terms = append(terms, quoted)
+		}
+		limit.OrderBy = terms
+		childLimits[resolved] = limit
+	}
+	opts.ChildLimits = childLimits
+
+	filters := make(map[string][]string)
+	for table, predicates := range opts.Filters {
+		resolved, err := e.Metadata.ResolveTable(table)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --where table: %w", err)
+		}
+		for _, predicate := range predicates {
+			if err := checkParentheses(predicate); err != nil {
+				return nil, fmt.Errorf("invalid --where predicate for %s: %w", resolved, err)
+			}
+			if err := e.Connection.ValidatePredicate(ctx, resolved, predicate); err != nil {
+				return nil, fmt.Errorf("invalid --where predicate for %s: %w", resolved, err)
+			}
+		}
+		filters[resolved] = append(filters[resolved], predicates...)
+	}
+	opts.Filters = filters
+
+	for i, table := range opts.ExcludedTables {
+		resolved, err := e.Metadata.ResolveTable(table)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --exclude-table: %w", err)
+		}
+		if rootTables[resolved] {
+			return nil, fmt.Errorf("cannot exclude the root table %s", resolved)
+		}
+		opts.ExcludedTables[i] = resolved
+	}
+
+	for i, edge := range opts.ExcludedEdges {
+		resolved, err := e.resolveExcludedEdge(edge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --exclude-edge: %w", err)
+		}
+		opts.ExcludedEdges[i] = resolved
+	}
+
+	return roots, nil
+}
+
+// resolveExcludedEdge resolves the table names of edge and checks that it
+// describes an existing foreign key.
+func (e *Engine) resolveExcludedEdge(edge ExcludedEdge) (ExcludedEdge, error) {
+	child, err := e.Metadata.ResolveTable(edge.ChildTable)
+	if err != nil {
+		return edge, err
+	}
+	parent, err := e.Metadata.ResolveTable(edge.ParentTable)
+	if err != nil {
+		return edge, err
+	}
+
+	resolved := ExcludedEdge{ChildTable: child, ChildColumns: edge.ChildColumns, ParentTable: parent}
+	for _, fk := range e.Graph.GetParents(child) {
+		if resolved.matches(fk) {
+			return resolved, nil
+		}
+	}
+
+	return edge, fmt.Errorf("no foreign key from %s (%s) to %s", child, strings.Join(edge.ChildColumns, ", "), parent)
+}
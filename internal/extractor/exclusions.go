@@ -0,0 +1,169 @@
+package extractor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+)
+
+// ExcludedEdge identifies a foreign key that traversal must not follow, by its
+// child table and columns and its parent table.
+type ExcludedEdge struct {
+	ChildTable   string   `json:"child_table"`
+	ChildColumns []string `json:"child_columns"`
+	ParentTable  string   `json:"parent_table"`
+}
+
+// ParseExcludedEdge parses an --exclude-edge value of the form
+// "child.column->parent", or "child.(a, b)->parent" for composite keys.
+// Table names may be schema-qualified.
+func ParseExcludedEdge(value string) (ExcludedEdge, error) {
+	invalid := fmt.Errorf("invalid excluded edge '%s' (expected child.column->parent)", value)
+
+	child, parent, ok := strings.Cut(value, "->")
+	child, parent = strings.TrimSpace(child), strings.TrimSpace(parent)
+	if !ok || parent == "" {
+		return ExcludedEdge{}, invalid
+	}
+
+	edge := ExcludedEdge{ParentTable: parent}
+
+	if strings.HasSuffix(child, ")") {
+		table, columns, ok := strings.Cut(strings.TrimSuffix(child, ")"), ".(")
+		if !ok {
+			return ExcludedEdge{}, invalid
+		}
+		edge.ChildTable = strings.TrimSpace(table)
+		for _, col := range strings.Split(columns, ",") {
+			edge.ChildColumns = append(edge.ChildColumns, strings.TrimSpace(col))
+		}
+	} else {
+		dot := strings.LastIndex(child, ".")
+		if dot < 0 {
+			return ExcludedEdge{}, invalid
+		}
+		edge.ChildTable = child[:dot]
+		edge.ChildColumns = []string{child[dot+1:]}
+	}
+
+	if edge.ChildTable == "" {
+		return ExcludedEdge{}, invalid
+	}
+	for _, col := range edge.ChildColumns {
+		if col == "" {
+			return ExcludedEdge{}, invalid
+		}
+	}
+
+	return edge, nil
+}
+
+// matches reports whether fk is the foreign key described by the edge. Table
+// names must already be resolved; column order does not matter.
+func (e ExcludedEdge) matches(fk db.ForeignKey) bool {
+	if fk.ChildTable != e.ChildTable || fk.ParentTable != e.ParentTable || len(fk.ChildColumns) != len(e.ChildColumns) {
+		return false
+	}
+
+	columns := make(map[string]bool)
+	for _, col := range e.ChildColumns {
+		columns[col] = true
+	}
+	for _, col := range fk.ChildColumns {
+		if !columns[col] {
+			return false
+		}
+	}
+	return true
+}
+
+// Excludes reports whether traversal must not follow fk, in either direction,
+// because its child or parent table or the edge itself was excluded.
+func (o *TraversalOptions) Excludes(fk db.ForeignKey) bool {
+	for _, table := range o.ExcludedTables {
+		if fk.ChildTable == table || fk.ParentTable == table {
+			return true
+		}
+	}
+	for _, edge := range o.ExcludedEdges {
+		if edge.matches(fk) {
+			return true
+		}
+	}
+	return false
+}
+
+// nullExcluded sets the columns of foreign keys to excluded parents to NULL in
+// row where possible (see droppableColumns). The references can then be loaded
+// without the parent rows.
+func (ts *TraversalState) nullExcluded(tableName string, row map[string]interface{}) {
+	for _, fk := range ts.Graph.GetParents(tableName) {
+		if !ts.Options.Excludes(fk) {
+			continue
+		}
+		for _, col := range ts.droppableColumns(tableName, fk) {
+			if _, exists := row[col]; exists {
+				row[col] = nil
+			}
+		}
+	}
+}
+
+// droppableColumns returns the columns of fk, a foreign key of tableName to an
+// excluded parent, that are set to NULL to drop its reference: those of no
+// foreign key that is still followed, which must keep referencing their
+// extracted parents. A NULL in any column is enough for a composite reference
+// not to be checked. It returns none if a column of fk is NOT NULL or every
+// column is shared with a followed foreign key.
+func (ts *TraversalState) droppableColumns(tableName string, fk db.ForeignKey) []string {
+	if !ts.Graph.IsNullable(tableName, fk.ChildColumns) {
+		return nil
+	}
+
+	retained := make(map[string]bool)
+	for _, other := range ts.Graph.GetParents(tableName) {
+		if ts.Options.Excludes(other) {
+			continue
+		}
+		for _, col := range other.ChildColumns {
+			retained[col] = true
+		}
+	}
+
+	columns := make([]string, 0, len(fk.ChildColumns))
+	for _, col := range fk.ChildColumns {
+		if !retained[col] {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+// AssumedPresent returns the foreign keys of extracted rows whose parents were
+// excluded and could not be nulled, because the FK columns are NOT NULL or
+// shared with followed foreign keys. The referenced parent rows must already
+// exist wherever the output is loaded. Virtual foreign keys are not included
+// since nothing enforces them.
+func (ts *TraversalState) AssumedPresent() []db.ForeignKey {
+	assumed := make([]db.ForeignKey, 0)
+
+	for _, tableName := range ts.Rows.Tables() {
+		for _, fk := range ts.Graph.GetParents(tableName) {
+			if fk.Virtual || !ts.Options.Excludes(fk) || len(ts.droppableColumns(tableName, fk)) > 0 {
+				continue
+			}
+			assumed = append(assumed, fk)
+		}
+	}
+
+	sort.Slice(assumed, func(i, j int) bool {
+		if assumed[i].ChildTable != assumed[j].ChildTable {
+			return assumed[i].ChildTable < assumed[j].ChildTable
+		}
+		return assumed[i].Name < assumed[j].Name
+	})
+
+	return assumed
+}
@@ -0,0 +1,91 @@
+package extractor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+	"github.com/riyasyash/pg_rocket/internal/graph"
+	"github.com/riyasyash/pg_rocket/internal/storage"
+)
+
+func TestNullExcludedKeepsSharedColumns(t *testing.T) {
+	projectFK := db.ForeignKey{
+		Name:         "tasks_project_fkey",
+		ChildTable:   "public.tasks",
+		ChildColumns: []string{"tenant_id", "project_id"},
+		ParentTable:  "public.projects",
+	}
+	reviewerFK := db.ForeignKey{
+		Name:         "tasks_reviewer_fkey",
+		ChildTable:   "public.tasks",
+		ChildColumns: []string{"tenant_id", "reviewer_id"},
+		ParentTable:  "public.users",
+	}
+	tenantFK := db.ForeignKey{
+		Name:         "tasks_tenant_fkey",
+		ChildTable:   "public.tasks",
+		ChildColumns: []string{"tenant_id"},
+		ParentTable:  "public.tenants",
+	}
+
+	g := graph.NewGraph(&db.Metadata{
+		Parents: map[string][]db.ForeignKey{"public.tasks": {projectFK, reviewerFK, tenantFK}},
+		Columns: map[string][]db.Column{"public.tasks": {
+			{Name: "id", NotNull: true},
+			{Name: "tenant_id"},
+			{Name: "project_id"},
+			{Name: "reviewer_id"},
+		}},
+	})
+
+	tests := []struct {
+		name     string
+		excluded []string
+		want     map[string]interface{}
+		assumed  []string
+	}{
+		{
+			name:     "shared column kept for a followed foreign key",
+			excluded: []string{"public.users"},
+			want:     map[string]interface{}{"id": 1, "tenant_id": 7, "project_id": 2, "reviewer_id": nil},
+			assumed:  []string{},
+		},
+		{
+			name:     "only shared columns",
+			excluded: []string{"public.tenants"},
+			want:     map[string]interface{}{"id": 1, "tenant_id": 7, "project_id": 2, "reviewer_id": 3},
+			assumed:  []string{"tasks_tenant_fkey"},
+		},
+		{
+			name:     "no followed foreign key left",
+			excluded: []string{"public.projects", "public.users", "public.tenants"},
+			want:     map[string]interface{}{"id": 1, "tenant_id": nil, "project_id": nil, "reviewer_id": nil},
+			assumed:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := storage.NewMemoryStore(g.GetRowKeyColumns)
+			ts := &TraversalState{Graph: g, Options: &TraversalOptions{ExcludedTables: tt.excluded}, Rows: rows}
+
+			row := map[string]interface{}{"id": 1, "tenant_id": 7, "project_id": 2, "reviewer_id": 3}
+			ts.nullExcluded("public.tasks", row)
+			if !reflect.DeepEqual(row, tt.want) {
+				t.Errorf("row = %v, want %v", row, tt.want)
+			}
+
+			if _, err := rows.Add("public.tasks", "1", row); err != nil {
+				t.Fatal(err)
+			}
+			assumed := make([]string, 0)
+			for _, fk := range ts.AssumedPresent() {
+				assumed = append(assumed, fk.Name)
+			}
+			if !reflect.DeepEqual(assumed, tt.assumed) {
+				t.Errorf("AssumedPresent = %v, want %v", assumed, tt.assumed)
+			}
+		})
+	}
+}
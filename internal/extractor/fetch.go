@@ -0,0 +1,127 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+)
+
+// fetchTask is one batched query of a traversal round. Running a task only
+// reads the task, so tasks can run concurrently.
+type fetchTask struct {
+	table   string        // Table the rows are fetched from
+	query   string        // Fetch query, with the key batch as parameters
+	args    []interface{} // Query parameters
+	depth   rowDepth      // Depth recorded for the fetched rows
+	limited bool          // Whether the table's --table-limit applies to the rows
+}
+
+// fetchResult holds the rows fetched by a task, or the error it failed with.
+type fetchResult struct {
+	rows []map[string]interface{}
+	err  error
+}
+
+// fetchJob is a task handed to a worker, with the channel its result is
+// delivered on.
+type fetchJob struct {
+	task   fetchTask
+	result chan fetchResult
+}
+
+// runTasks runs the tasks passed to emit by produce with one worker per
+// snapshot transaction (see Options.Parallelism) and merges their rows into
+// the state in task order, so the result does not depend on which queries
+// finish first. Tasks are built as the workers take them: once twice as many
+// tasks as workers await merging, emit merges the oldest before handing out
+// another, which bounds both the tasks and the fetched rows held in memory.
+// produce and the merges run on the calling goroutine, the only one using
+// Rows and RowCount; workers just fetch. All workers have stopped by the time
+// runTasks returns.
+func (ts *TraversalState) runTasks(ctx context.Context, produce func(emit func(fetchTask) error) error) error {
+	// Cancel outstanding queries first, then wait for their workers, which
+	// must not use a transaction after it is closed
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan fetchJob)
+	defer close(jobs)
+
+	for _, querier := range ts.queriers {
+		wg.Add(1)
+		go func(querier db.Querier) {
+			defer wg.Done()
+			for job := range jobs {
+				rows, err := runTask(ctx, querier, job.task)
+				job.result <- fetchResult{rows: rows, err: err}
+			}
+		}(querier)
+	}
+
+	queue := make([]fetchJob, 0) // Handed out and not merged yet, in task order
+	merge := func() error {
+		job := queue[0]
+		queue = queue[1:]
+
+		var result fetchResult
+		select {
+		case result = <-job.result:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if result.err != nil {
+			return result.err
+		}
+		return ts.addRows(job.task, result.rows)
+	}
+
+	emit := func(task fetchTask) error {
+		if len(queue) == 2*len(ts.queriers) {
+			if err := merge(); err != nil {
+				return err
+			}
+		}
+
+		job := fetchJob{task: task, result: make(chan fetchResult, 1)}
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		queue = append(queue, job)
+		return nil
+	}
+
+	if err := produce(emit); err != nil {
+		return err
+	}
+	for len(queue) > 0 {
+		if err := merge(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runTask executes a task's query with querier and reads all of its rows.
+func runTask(ctx context.Context, querier db.Querier, task fetchTask) ([]map[string]interface{}, error) {
+	rows, err := querier.Query(ctx, task.query, task.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rows from %s: %w", task.table, err)
+	}
+	defer rows.Close()
+
+	result, err := scanRows(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rows from %s: %w", task.table, err)
+	}
+
+	return result, nil
+}
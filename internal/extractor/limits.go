@@ -0,0 +1,148 @@
+package extractor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+	"github.com/riyasyash/pg_rocket/internal/graph"
+)
+
+// rowNumberColumn is the window column used to apply per-parent child limits.
+const rowNumberColumn = "pg_rocket_row_number"
+
+// ChildLimit caps the rows fetched from a child table for each parent row.
+type ChildLimit struct {
+	PerParent int      `json:"per_parent"` // Maximum rows kept per referenced parent row
+	OrderBy   []string `json:"order_by"`   // Order terms choosing the rows kept, e.g. "created_at DESC"
+}
+
+// ParseTableLimit parses a --table-limit value of the form "table=N".
+func ParseTableLimit(value string) (string, int, error) {
+	table, limit, ok := strings.Cut(value, "=")
+	table = strings.TrimSpace(table)
+	if !ok || table == "" {
+		return "", 0, fmt.Errorf("invalid table limit '%s' (expected table=N)", value)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	if err != nil || n < 0 {
+		return "", 0, fmt.Errorf("invalid table limit '%s': limit must be a non-negative integer", value)
+	}
+
+	return table, n, nil
+}
+
+// ParseChildLimit parses a --child-limit value of the form "table=N" or
+// "table=N:order", e.g. "orders=20:created_at DESC".
+func ParseChildLimit(value string) (string, ChildLimit, error) {
+	spec, order, _ := strings.Cut(value, ":")
+
+	table, n, err := ParseTableLimit(spec)
+	if err != nil {
+		return "", ChildLimit{}, fmt.Errorf("invalid child limit '%s' (expected table=N[:column [ASC|DESC], ...])", value)
+	}
+	if n == 0 {
+		return "", ChildLimit{}, fmt.Errorf("invalid child limit '%s': limit must be positive", value)
+	}
+
+	limit := ChildLimit{PerParent: n}
+	for _, term := range strings.Split(order, ",") {
+		if term = strings.Join(strings.Fields(term), " "); term != "" {
+			limit.OrderBy = append(limit.OrderBy, term)
+		}
+	}
+
+	return table, limit, nil
+}
+
+// orderTerm checks that an ORDER BY term is a column of table followed by
+// optional ASC/DESC and NULLS FIRST/LAST modifiers, and returns it with the
+// column quoted and the modifiers in upper case, e.g. "created_at" DESC.
+func orderTerm(g *graph.Graph, table, term string) (string, error) {
+	fields := strings.Fields(term)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty order for table %s", table)
+	}
+
+	found := false
+	for _, col := range g.GetColumns(table) {
+		if col.Name == fields[0] {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("column '%s' not found in table %s", fields[0], table)
+	}
+
+	modifiers := strings.ToUpper(strings.Join(fields[1:], " "))
+	for _, allowed := range []string{"", "ASC", "DESC", "NULLS FIRST", "NULLS LAST",
+		"ASC NULLS FIRST", "ASC NULLS LAST", "DESC NULLS FIRST", "DESC NULLS LAST"} {
+		if modifiers == allowed {
+			return strings.TrimSpace(db.QuoteIdentifier(fields[0]) + " " + modifiers), nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid order '%s' for table %s (expected column [ASC|DESC] [NULLS FIRST|LAST])", term, table)
+}
+
+// orderColumns returns the columns giving a table's rows a total order: its row
+// key, or for keyless tables every column that supports ordering.
+func orderColumns(g *graph.Graph, table string) []string {
+	if keyColumns := g.GetRowKeyColumns(table); len(keyColumns) > 0 {
+		return keyColumns
+	}
+
+	columns := make([]string, 0)
+	for _, col := range g.GetColumns(table) {
+		// The json type has no ordering operator
+		if !col.IsJSON() {
+			columns = append(columns, col.Name)
+		}
+	}
+	return columns
+}
+
+// childQuery builds the query fetching the rows of tableName that match
+// condition, a predicate on the foreign key columns fkColumns, and the table's
+// --where filters. A child limit for the table keeps only the first rows per
+// parent using ROW_NUMBER, ordered by its terms (as returned by orderTerm),
+// and a non-negative remaining caps the total, so truncation is deterministic.
+func childQuery(g *graph.Graph, opts *TraversalOptions, tableName string, selectCols []string, fkColumns []string, condition string, remaining int) string {
+	order := orderColumns(g, tableName)
+
+	for _, filter := range opts.Filters[tableName] {
+		condition = fmt.Sprintf("%s AND (%s\n)", condition, filter)
+	}
+
+	source := db.QuoteTable(tableName)
+	where := condition
+
+	if limit, ok := opts.ChildLimits[tableName]; ok {
+		window := "PARTITION BY " + strings.Join(fkColumns, ", ")
+		if windowOrder := append(append([]string{}, limit.OrderBy...), order...); len(windowOrder) > 0 {
+			window += " ORDER BY " + strings.Join(windowOrder, ", ")
+		}
+		source = fmt.Sprintf("(SELECT *, ROW_NUMBER() OVER (%s) AS %s FROM %s WHERE %s) AS limited",
+			window, rowNumberColumn, source, condition)
+		where = fmt.Sprintf("%s <= %d", rowNumberColumn, limit.PerParent)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(selectCols, ", "), source, where)
+
+	// Order by the row key where there is one; keyless tables are sorted on
+	// output unless a limit needs a deterministic order
+	if keyColumns := g.GetRowKeyColumns(tableName); len(keyColumns) > 0 {
+		query += " ORDER BY " + strings.Join(keyColumns, ", ")
+	} else if remaining >= 0 && len(order) > 0 {
+		query += " ORDER BY " + strings.Join(order, ", ")
+	}
+
+	if remaining >= 0 {
+		query += fmt.Sprintf(" LIMIT %d", remaining)
+	}
+
+	return query
+}
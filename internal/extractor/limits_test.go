@@ -0,0 +1,174 @@
+package extractor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+	"github.com/riyasyash/pg_rocket/internal/graph"
+)
+
+func newLimitsGraph() *graph.Graph {
+	return graph.NewGraph(&db.Metadata{
+		PrimaryKey: map[string][]string{"public.orders": {"id"}},
+		Columns: map[string][]db.Column{
+			"public.orders": {
+				{Name: "id", NotNull: true},
+				{Name: "tenant_id"},
+				{Name: "user_id"},
+				{Name: "createdAt"},
+			},
+			"public.events": {{Name: "user_id"}, {Name: "kind"}, {Name: "payload", DataType: "jsonb"}},
+		},
+	})
+}
+
+func TestParseChildLimit(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantTable string
+		want      ChildLimit
+		wantErr   bool
+	}{
+		{value: "orders=20", wantTable: "orders", want: ChildLimit{PerParent: 20}},
+		{value: "orders=20:created_at DESC", wantTable: "orders", want: ChildLimit{PerParent: 20, OrderBy: []string{"created_at DESC"}}},
+		{value: " orders = 5 : created_at  desc , id ,", wantTable: "orders", want: ChildLimit{PerParent: 5, OrderBy: []string{"created_at desc", "id"}}},
+		{value: "orders=0", wantErr: true},
+		{value: "orders=-1", wantErr: true},
+		{value: "orders=x", wantErr: true},
+		{value: "=5", wantErr: true},
+		{value: "orders", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		table, got, err := ParseChildLimit(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseChildLimit(%q) = %q, %+v; want an error", tt.value, table, got)
+			}
+			continue
+		}
+		if err != nil || table != tt.wantTable || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseChildLimit(%q) = %q, %+v, %v; want %q, %+v", tt.value, table, got, err, tt.wantTable, tt.want)
+		}
+	}
+}
+
+func TestOrderTerm(t *testing.T) {
+	g := newLimitsGraph()
+
+	tests := []struct {
+		term    string
+		want    string
+		wantErr bool
+	}{
+		{term: "id", want: `"id"`},
+		{term: "createdAt desc", want: `"createdAt" DESC`},
+		{term: "createdAt asc nulls last", want: `"createdAt" ASC NULLS LAST`},
+		{term: "user_id NULLS FIRST", want: `"user_id" NULLS FIRST`},
+		{term: "createdat", wantErr: true},
+		{term: "missing DESC", wantErr: true},
+		{term: "id DESC; DROP TABLE orders", wantErr: true},
+		{term: "id SIDEWAYS", wantErr: true},
+		{term: "id NULLS", wantErr: true},
+		{term: "(SELECT 1)", wantErr: true},
+		{term: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := orderTerm(g, "public.orders", tt.term)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("orderTerm(%q) = %q, want an error", tt.term, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("orderTerm(%q) = %q, %v; want %q", tt.term, got, err, tt.want)
+		}
+	}
+}
+
+func TestChildQuery(t *testing.T) {
+	g := newLimitsGraph()
+	selectCols := []string{"id", "tenant_id", "user_id"}
+
+	tests := []struct {
+		name       string
+		opts       *TraversalOptions
+		table      string
+		fkColumns  []string
+		condition  string
+		remaining  int
+		selectCols []string
+		want       string
+	}{
+		{
+			name:      "no limits",
+			opts:      &TraversalOptions{},
+			table:     "public.orders",
+			fkColumns: []string{"user_id"},
+			condition: "user_id IN ($1, $2)",
+			remaining: -1,
+			want:      `SELECT id, tenant_id, user_id FROM "public"."orders" WHERE user_id IN ($1, $2) ORDER BY id`,
+		},
+		{
+			name:      "table limit and filter",
+			opts:      &TraversalOptions{Filters: map[string][]string{"public.orders": {"user_id > 0"}}},
+			table:     "public.orders",
+			fkColumns: []string{"user_id"},
+			condition: "user_id IN ($1)",
+			remaining: 10,
+			want:      "SELECT id, tenant_id, user_id FROM \"public\".\"orders\" WHERE user_id IN ($1) AND (user_id > 0\n) ORDER BY id LIMIT 10",
+		},
+		{
+			name: "per-parent limit on a single-column foreign key",
+			opts: &TraversalOptions{ChildLimits: map[string]ChildLimit{
+				"public.orders": {PerParent: 20, OrderBy: []string{`"createdAt" DESC`}},
+			}},
+			table:     "public.orders",
+			fkColumns: []string{"user_id"},
+			condition: "user_id IN ($1)",
+			remaining: -1,
+			want: `SELECT id, tenant_id, user_id FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY "createdAt" DESC, id) AS pg_rocket_row_number ` +
+				`FROM "public"."orders" WHERE user_id IN ($1)) AS limited WHERE pg_rocket_row_number <= 20 ORDER BY id`,
+		},
+		{
+			name: "per-parent limit on a composite foreign key",
+			opts: &TraversalOptions{ChildLimits: map[string]ChildLimit{
+				"public.orders": {PerParent: 3},
+			}},
+			table:     "public.orders",
+			fkColumns: []string{"tenant_id", "user_id"},
+			condition: "(tenant_id, user_id) IN (($1, $2))",
+			remaining: 100,
+			want: `SELECT id, tenant_id, user_id FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY tenant_id, user_id ORDER BY id) AS pg_rocket_row_number ` +
+				`FROM "public"."orders" WHERE (tenant_id, user_id) IN (($1, $2))) AS limited WHERE pg_rocket_row_number <= 3 ORDER BY id LIMIT 100`,
+		},
+		{
+			name: "keyless table ordered on its orderable columns",
+			opts: &TraversalOptions{ChildLimits: map[string]ChildLimit{
+				"public.events": {PerParent: 2},
+			}},
+			table:      "public.events",
+			fkColumns:  []string{"user_id"},
+			condition:  "user_id IN ($1)",
+			remaining:  5,
+			selectCols: []string{"user_id", "kind", "to_jsonb(payload)::text AS payload"},
+			want: `SELECT user_id, kind, to_jsonb(payload)::text AS payload FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY user_id, kind) AS pg_rocket_row_number ` +
+				`FROM "public"."events" WHERE user_id IN ($1)) AS limited WHERE pg_rocket_row_number <= 2 ORDER BY user_id, kind LIMIT 5`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cols := selectCols
+			if tt.selectCols != nil {
+				cols = tt.selectCols
+			}
+			if got := childQuery(g, tt.opts, tt.table, cols, tt.fkColumns, tt.condition, tt.remaining); got != tt.want {
+				t.Errorf("childQuery() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
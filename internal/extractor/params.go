@@ -0,0 +1,158 @@
+package extractor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// QueryParam is a value bound to the root queries. The n-th --param binds $n
+// in every root query, and also binds the :name placeholders with its name.
+type QueryParam struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type,omitempty"` // Empty for untyped values, sent as text
+	Value interface{} `json:"value"`
+}
+
+// paramParsers convert the text of a typed --param value to the Go value
+// bound to its placeholder, by type name.
+var paramParsers = map[string]func(string) (interface{}, error){
+	"text": func(value string) (interface{}, error) { return value, nil },
+	"int": func(value string) (interface{}, error) {
+		return strconv.ParseInt(value, 10, 64)
+	},
+	"float": func(value string) (interface{}, error) {
+		return strconv.ParseFloat(value, 64)
+	},
+	"bool": func(value string) (interface{}, error) {
+		return strconv.ParseBool(value)
+	},
+	"date": func(value string) (interface{}, error) {
+		return time.Parse(time.DateOnly, value)
+	},
+	"timestamp": func(value string) (interface{}, error) {
+		return time.Parse(time.RFC3339, value)
+	},
+	"uuid": func(value string) (interface{}, error) {
+		if !uuidPattern.MatchString(value) {
+			return nil, fmt.Errorf("invalid uuid")
+		}
+		return value, nil
+	},
+}
+
+// uuidPattern matches the input forms of PostgreSQL's uuid type: 32 hex digits,
+// optionally hyphenated as 8-4-4-4-12 and wrapped in braces.
+var uuidPattern = regexp.MustCompile(`^(\{[0-9a-fA-F]{8}(-?[0-9a-fA-F]{4}){3}-?[0-9a-fA-F]{12}\}|[0-9a-fA-F]{8}(-?[0-9a-fA-F]{4}){3}-?[0-9a-fA-F]{12})$`)
+
+// paramNamePattern matches the names a :name placeholder can refer to.
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// paramTypeAliases maps PostgreSQL type names to the names in paramParsers.
+var paramTypeAliases = map[string]string{
+	"varchar":     "text",
+	"integer":     "int",
+	"bigint":      "int",
+	"smallint":    "int",
+	"int2":        "int",
+	"int4":        "int",
+	"int8":        "int",
+	"double":      "float",
+	"real":        "float",
+	"float4":      "float",
+	"float8":      "float",
+	"boolean":     "bool",
+	"timestamptz": "timestamp",
+}
+
+// ParseQueryParam parses a --param value of the form "name=value" or
+// "name:type=value", e.g. "user_id:int=42". Typed values are checked and
+// converted here; untyped values are sent as text and converted by PostgreSQL
+// to the type of their placeholder.
+func ParseQueryParam(value string) (QueryParam, error) {
+	spec, raw, ok := strings.Cut(value, "=")
+	name, typ, typed := strings.Cut(spec, ":")
+	name, typ = strings.TrimSpace(name), strings.ToLower(strings.TrimSpace(typ))
+	if !ok || name == "" || (typed && typ == "") {
+		return QueryParam{}, fmt.Errorf("invalid param '%s' (expected name=value or name:type=value)", value)
+	}
+
+	if !paramNamePattern.MatchString(name) {
+		return QueryParam{}, fmt.Errorf("invalid param '%s': name must be an identifier (letters, digits and _)", value)
+	}
+
+	param := QueryParam{Name: name, Type: typ, Value: raw}
+	if !typed {
+		return param, nil
+	}
+
+	if alias, ok := paramTypeAliases[typ]; ok {
+		typ = alias
+	}
+	parse, ok := paramParsers[typ]
+	if !ok {
+		return QueryParam{}, fmt.Errorf("invalid param '%s': unsupported type %s (use text, uuid, int, float, bool, date or timestamp)", value, param.Type)
+	}
+
+	converted, err := parse(raw)
+	if err != nil {
+		return QueryParam{}, fmt.Errorf("invalid param '%s': %s value expected", value, param.Type)
+	}
+	param.Value = converted
+
+	return param, nil
+}
+
+// bindParams returns sql with the values its placeholders bind: the values of
+// params up to the highest $n it uses, in order, then those of its :name
+// placeholders naming one of params, numbered after the $n in order of first
+// use. Casts (::), strings, comments, names of no param and a colon right
+// after a name or number, as in the array slice a[1:n], are kept.
+func bindParams(sql string, params []QueryParam) (string, []interface{}) {
+	args := make([]interface{}, 0)
+	for _, param := range params[:min(maxPlaceholder(sql), len(params))] {
+		args = append(args, param.Value)
+	}
+
+	values := make(map[string]interface{}, len(params))
+	for _, param := range params {
+		values[param.Name] = param.Value
+	}
+
+	var bound strings.Builder
+	numbers := make(map[string]int)
+	last := 0
+
+	scanTokens(sql, func(start, end int) {
+		if sql[start] != ':' || (start > 0 && (sql[start-1] == ':' || isIdentifierChar(sql[start-1]))) {
+			return
+		}
+
+		nameEnd := end
+		for nameEnd < len(sql) && sql[nameEnd] != '$' && isIdentifierChar(sql[nameEnd]) {
+			nameEnd++
+		}
+		value, ok := values[sql[end:nameEnd]]
+		if !ok || !isIdentifierStart(sql[end]) {
+			return
+		}
+
+		name := sql[end:nameEnd]
+		if _, ok := numbers[name]; !ok {
+			args = append(args, value)
+			numbers[name] = len(args)
+		}
+		fmt.Fprintf(&bound, "%s$%d", sql[last:start], numbers[name])
+		last = nameEnd
+	})
+	bound.WriteString(sql[last:])
+
+	return bound.String(), args
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || unicode.IsLetter(rune(c))
+}
@@ -0,0 +1,130 @@
+package extractor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseQueryParam(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    QueryParam
+		wantErr bool
+	}{
+		{value: "slug=acme", want: QueryParam{Name: "slug", Value: "acme"}},
+		{value: "note=a=b", want: QueryParam{Name: "note", Value: "a=b"}},
+		{value: "empty=", want: QueryParam{Name: "empty", Value: ""}},
+		{value: "id:int=42", want: QueryParam{Name: "id", Type: "int", Value: int64(42)}},
+		{value: "id:BIGINT=-7", want: QueryParam{Name: "id", Type: "bigint", Value: int64(-7)}},
+		{value: "ratio:float=0.5", want: QueryParam{Name: "ratio", Type: "float", Value: 0.5}},
+		{value: "active:bool=true", want: QueryParam{Name: "active", Type: "bool", Value: true}},
+		{value: "name:varchar=x", want: QueryParam{Name: "name", Type: "varchar", Value: "x"}},
+		{value: "day:date=2024-01-31", want: QueryParam{Name: "day", Type: "date", Value: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)}},
+		{value: "at:timestamp=2024-01-31T12:00:00Z", want: QueryParam{Name: "at", Type: "timestamp", Value: time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)}},
+		{value: "u:uuid=a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", want: QueryParam{Name: "u", Type: "uuid", Value: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"}},
+		{value: "u:uuid={A0EEBC999C0B4EF8BB6D6BB9BD380A11}", want: QueryParam{Name: "u", Type: "uuid", Value: "{A0EEBC999C0B4EF8BB6D6BB9BD380A11}"}},
+		{value: "u:uuid=abc", wantErr: true},
+		{value: "u:uuid=a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a1", wantErr: true},
+		{value: "id:int=abc", wantErr: true},
+		{value: "day:date=31/01/2024", wantErr: true},
+		{value: "id:money=1", wantErr: true},
+		{value: "id:=1", wantErr: true},
+		{value: "=1", wantErr: true},
+		{value: "noequals", wantErr: true},
+		{value: "user-id=1", wantErr: true},
+		{value: "1id=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseQueryParam(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseQueryParam(%q) = %+v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseQueryParam(%q) = %+v, %v; want %+v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestBindParams(t *testing.T) {
+	params := []QueryParam{
+		{Name: "org", Value: int64(7)},
+		{Name: "since", Value: "2024-01-01"},
+		{Name: "n", Value: int64(3)},
+	}
+
+	tests := []struct {
+		name     string
+		sql      string
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "numbered in order of use",
+			sql:      "SELECT id FROM t WHERE created_at >= :since AND org_id = :org",
+			wantSQL:  "SELECT id FROM t WHERE created_at >= $1 AND org_id = $2",
+			wantArgs: []interface{}{"2024-01-01", int64(7)},
+		},
+		{
+			name:     "positional placeholders bind values in flag order",
+			sql:      "SELECT id FROM t WHERE org_id = $1 AND created_at >= $2",
+			wantSQL:  "SELECT id FROM t WHERE org_id = $1 AND created_at >= $2",
+			wantArgs: []interface{}{int64(7), "2024-01-01"},
+		},
+		{
+			name:     "positional placeholders bind a prefix of the values",
+			sql:      "SELECT id FROM t WHERE org_id = $1",
+			wantSQL:  "SELECT id FROM t WHERE org_id = $1",
+			wantArgs: []interface{}{int64(7)},
+		},
+		{
+			name:     "names are numbered after positional placeholders",
+			sql:      "SELECT id FROM t WHERE created_at >= $2 AND a = :n AND b = :org",
+			wantSQL:  "SELECT id FROM t WHERE created_at >= $2 AND a = $3 AND b = $4",
+			wantArgs: []interface{}{int64(7), "2024-01-01", int64(3), int64(7)},
+		},
+		{
+			name:     "repeated name binds one value",
+			sql:      "SELECT id FROM t WHERE a = :org OR b = :org",
+			wantSQL:  "SELECT id FROM t WHERE a = $1 OR b = $1",
+			wantArgs: []interface{}{int64(7)},
+		},
+		{
+			name:     "only used values",
+			sql:      "SELECT id FROM t WHERE org_id = :org",
+			wantSQL:  "SELECT id FROM t WHERE org_id = $1",
+			wantArgs: []interface{}{int64(7)},
+		},
+		{
+			name:     "casts, strings, comments and unknown names are kept",
+			sql:      "SELECT id::text, ':org', \":org\" FROM t -- :org\nWHERE x = :other AND y = :org::int /* :since */",
+			wantSQL:  "SELECT id::text, ':org', \":org\" FROM t -- :org\nWHERE x = :other AND y = $1::int /* :since */",
+			wantArgs: []interface{}{int64(7)},
+		},
+		{
+			name:     "longer name is not a prefix match",
+			sql:      "SELECT id FROM t WHERE a = :organization",
+			wantSQL:  "SELECT id FROM t WHERE a = :organization",
+			wantArgs: []interface{}{},
+		},
+		{
+			name:     "array slice bound is not a placeholder",
+			sql:      "SELECT a[1:n], a[:n] FROM t",
+			wantSQL:  "SELECT a[1:n], a[$1] FROM t",
+			wantArgs: []interface{}{int64(3)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSQL, gotArgs := bindParams(tt.sql, params)
+			if gotSQL != tt.wantSQL || !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("bindParams(%q) = %q, %v; want %q, %v", tt.sql, gotSQL, gotArgs, tt.wantSQL, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+	"github.com/riyasyash/pg_rocket/internal/graph"
+)
+
+// ExtractionPlan describes what an extraction would do without fetching any
+// data: the foreign keys followed, the resulting insert order and estimated
+// row counts.
+type ExtractionPlan struct {
+	Roots         []PlanRoot   `json:"roots"`
+	Params        []QueryParam `json:"params,omitempty"`
+	Steps         []PlanStep   `json:"steps"`
+	InsertOrder   []string     `json:"insert_order"`
+	Deferred      []string     `json:"deferred_foreign_keys"`
+	Postponed     []string     `json:"postponed_foreign_keys"`
+	Tables        []TablePlan  `json:"tables"`
+	EstimatedRows int64        `json:"estimated_rows"`
+	MaxRows       int          `json:"max_rows"`
+	Options       PlanOptions  `json:"options"`
+	fetchSets     []string     // CTE bodies, indexed like the "s<n>" set names
+}
+
+// PlanRoot is the set of rows one root query seeds a table with. A query
+// declaring several seed tables has one PlanRoot per seed table.
+type PlanRoot struct {
+	Set           string `json:"set"` // Name of the row set selected by the query (s0, s1, ...)
+	Table         string `json:"table"`
+	Query         string `json:"query"`
+	SeedQuery     string `json:"seed_query,omitempty"` // Fetch of the full rows by the keys Query projects; empty for keyless tables
+	EstimatedRows int64  `json:"estimated_rows"`       // Planner estimate for SeedQuery, or Query
+}
+
+// PlanOptions records the traversal options the plan was built with.
+type PlanOptions struct {
+	ParentsOnly      bool                  `json:"parents_only"`
+	ChildrenOnly     bool                  `json:"children_only"`
+	SelectedChildren []string              `json:"selected_children"`
+	MaxParentDepth   int                   `json:"max_parent_depth"`
+	MaxChildDepth    int                   `json:"max_child_depth"`
+	TableLimits      map[string]int        `json:"table_limits,omitempty"`
+	ChildLimits      map[string]ChildLimit `json:"child_limits,omitempty"`
+	Filters          map[string][]string   `json:"filters,omitempty"`
+	ExcludedTables   []string              `json:"excluded_tables,omitempty"`
+	ExcludedEdges    []ExcludedEdge        `json:"excluded_edges,omitempty"`
+	Sample           *Sample               `json:"sample,omitempty"`
+}
+
+// PlanStep is one foreign key the traversal follows, in traversal order.
+type PlanStep struct {
+	Set           string   `json:"set"`       // Name of the row set fetched by this step, numbered after the roots
+	Round         int      `json:"round"`     // Traversal round in which the foreign key is first followed
+	Direction     string   `json:"direction"` // graph.DirectionUp (to a parent) or graph.DirectionDown (to a child)
+	From          string   `json:"from"`
+	To            string   `json:"to"`
+	ForeignKey    string   `json:"foreign_key"`
+	FromColumns   []string `json:"from_columns"`
+	ToColumns     []string `json:"to_columns"`
+	Query         string   `json:"query,omitempty"`   // Fetch query, reading keys from the sets of From
+	EstimatedRows int64    `json:"estimated_rows"`    // Planner estimate for Query
+	Skipped       string   `json:"skipped,omitempty"` // Why the step fetches nothing, if it does not
+}
+
+// TablePlan summarizes the rows expected from one table.
+type TablePlan struct {
+	Name          string `json:"name"`
+	TableRows     int64  `json:"table_rows"`     // pg_class.reltuples, -1 if unknown
+	EstimatedRows int64  `json:"estimated_rows"` // Sum of the step estimates, capped at TableRows
+}
+
+// Plan validates the root queries and builds the extraction plan for them. Row
+// estimates come from pg_class.reltuples and from EXPLAIN of each fetch query,
+// where the keys of previous steps are composed as subqueries in place of the
+// literal key batches used during extraction. No data is fetched.
+func (e *Engine) Plan(ctx context.Context, queries []string, opts *TraversalOptions) (*ExtractionPlan, error) {
+	roots, err := e.prepare(ctx, queries, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rootTables := make([]string, 0, len(roots))
+	for _, queryInfo := range roots {
+		rootTables = append(rootTables, queryInfo.Tables()...)
+	}
+
+	plan := &ExtractionPlan{
+		Roots:     make([]PlanRoot, 0, len(roots)),
+		Params:    opts.Params,
+		Steps:     planSteps(e.Graph, rootTables, opts),
+		Deferred:  make([]string, 0),
+		Postponed: make([]string, 0),
+		Tables:    make([]TablePlan, 0),
+		MaxRows:   opts.MaxRows,
+		Options: PlanOptions{
+			ParentsOnly:      opts.ParentsOnly,
+			ChildrenOnly:     opts.ChildrenOnly,
+			SelectedChildren: opts.SelectedChildren,
+			MaxParentDepth:   opts.MaxParentDepth,
+			MaxChildDepth:    opts.MaxChildDepth,
+			TableLimits:      opts.TableLimits,
+			ChildLimits:      opts.ChildLimits,
+			Filters:          opts.Filters,
+			ExcludedTables:   opts.ExcludedTables,
+			ExcludedEdges:    opts.ExcludedEdges,
+			Sample:           opts.Sample,
+		},
+		fetchSets: make([]string, 0),
+	}
+
+	for _, queryInfo := range roots {
+		if err := plan.addRoots(ctx, e.Connection, e.Graph, queryInfo, opts.Sample); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := plan.estimateSteps(ctx, e.Connection, e.Graph, opts); err != nil {
+		return nil, err
+	}
+
+	// Traversal can reach tables outside the selected schemas through
+	// cross-schema foreign keys
+	tableRows, err := e.Connection.TableRowEstimates(ctx, e.Metadata.AllSchemas)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := plan.summarize(e.Graph, tableRows); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// addRoots adds the sets of the seed rows selected by a root query. Like the
+// sets of steps, they select every column.
+func (p *ExtractionPlan) addRoots(ctx context.Context, conn *db.Connection, g *graph.Graph, queryInfo *QueryInfo, sample *Sample) error {
+	for _, seed := range queryInfo.Seeds {
+		root := PlanRoot{
+			Set:   fmt.Sprintf("s%d", len(p.fetchSets)),
+			Table: seed.Table,
+			Query: queryInfo.Query,
+		}
+
+		set := queryInfo.rowsQuery([]string{"*"}, sample)
+		if len(seed.Columns) > 0 {
+			root.SeedQuery = seedQuery(g, seed, queryInfo.keyQuery(sample))
+			set = root.SeedQuery
+		}
+
+		bound, args := queryInfo.bind(set)
+		estimate, err := conn.EstimateRows(ctx, bound, args...)
+		if err != nil {
+			return fmt.Errorf("failed to estimate root rows of %s: %w", seed.Table, err)
+		}
+		root.EstimatedRows = estimate
+
+		p.Roots = append(p.Roots, root)
+		p.fetchSets = append(p.fetchSets, set)
+	}
+
+	return nil
+}
+
+// seedQuery returns a query for the rows of the seed table whose key keyQuery
+// selects, composing keyQuery as a subquery in place of the key batches used
+// during extraction.
+func seedQuery(g *graph.Graph, seed Seed, keyQuery string) string {
+	keyColumns := g.GetRowKeyColumns(seed.Table)
+
+	target := keyColumns[0]
+	if len(keyColumns) > 1 {
+		target = "(" + strings.Join(keyColumns, ", ") + ")"
+	}
+	projected := make([]string, len(seed.Columns))
+	for i, col := range seed.Columns {
+		projected[i] = db.QuoteIdentifier(col)
+	}
+
+	return fmt.Sprintf("SELECT * FROM %s WHERE %s IN (SELECT %s FROM %s)",
+		db.QuoteTable(seed.Table), target, strings.Join(projected, ", "), db.Subquery(keyQuery, "keys"))
+}
+
+// planSteps lists the foreign keys followed by TraversalState.Extract from the
+// root tables, assuming every table reached has rows. Like Extract it works in
+// rounds, following the foreign keys of the tables reached in the previous
+// round, until no table is reached at a smaller depth than before. Each foreign
+// key is listed once, in the first round that follows it.
+func planSteps(g *graph.Graph, rootTables []string, opts *TraversalOptions) []PlanStep {
+	steps := make([]PlanStep, 0)
+	seen := make(map[string]bool)
+
+	selected := make(map[string]bool)
+	for _, child := range opts.SelectedChildren {
+		selected[child] = true
+	}
+
+	// reachedTable is a table reached with rows at the given depths; childDepth
+	// is -1 when the rows were only fetched as parents
+	type reachedTable struct {
+		name        string
+		childDepth  int
+		parentDepth int
+	}
+
+	bestChild := make(map[string]int)
+	bestParent := make(map[string]int)
+
+	next := make([]reachedTable, 0)
+	reach := func(t reachedTable) {
+		improved := false
+		if best, ok := bestParent[t.name]; !ok || t.parentDepth < best {
+			bestParent[t.name] = t.parentDepth
+			improved = true
+		}
+		if best, ok := bestChild[t.name]; t.childDepth >= 0 && (!ok || t.childDepth < best) {
+			bestChild[t.name] = t.childDepth
+			improved = true
+		}
+		if improved {
+			next = append(next, t)
+		}
+	}
+
+	add := func(round int, direction string, fk db.ForeignKey) {
+		key := fmt.Sprintf("%s|%s|%s|%s", direction, fk.Name, fk.ChildTable, fk.ParentTable)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+
+		step := PlanStep{Round: round, Direction: direction, ForeignKey: fk.Name}
+		if direction == graph.DirectionUp {
+			step.From, step.To = fk.ChildTable, fk.ParentTable
+			step.FromColumns, step.ToColumns = fk.ChildColumns, fk.ParentColumns
+		} else {
+			step.From, step.To = fk.ParentTable, fk.ChildTable
+			step.FromColumns, step.ToColumns = fk.ParentColumns, fk.ChildColumns
+		}
+		steps = append(steps, step)
+	}
+
+	for _, table := range rootTables {
+		reach(reachedTable{name: table})
+	}
+
+	for round := 1; len(next) > 0; round++ {
+		frontier := next
+		next = make([]reachedTable, 0)
+		sort.SliceStable(frontier, func(i, j int) bool { return frontier[i].name < frontier[j].name })
+
+		for _, current := range frontier {
+			if !opts.ChildrenOnly && withinDepth(current.parentDepth, opts.MaxParentDepth) {
+				for _, fk := range g.GetParents(current.name) {
+					if opts.Excludes(fk) {
+						continue
+					}
+					add(round, graph.DirectionUp, fk)
+					reach(reachedTable{name: fk.ParentTable, childDepth: -1, parentDepth: current.parentDepth + 1})
+				}
+			}
+
+			if opts.ParentsOnly || current.childDepth < 0 || !withinDepth(current.childDepth, opts.MaxChildDepth) {
+				continue
+			}
+
+			for _, fk := range g.GetChildren(current.name) {
+				if len(selected) > 0 && !selected[fk.ChildTable] || opts.Excludes(fk) {
+					continue
+				}
+				add(round, graph.DirectionDown, fk)
+				reach(reachedTable{name: fk.ChildTable, childDepth: current.childDepth + 1})
+			}
+		}
+	}
+
+	return steps
+}
+
+// estimateSteps builds the fetch query of every step and asks the planner for
+// its row estimate. Each step's rows form a set named "s<n>", numbered after
+// the sets of the root queries. The keys a step looks up are read from all
+// earlier sets of its source table, which are passed to EXPLAIN as CTEs.
+// Child steps apply the same limits as fkTask, through childQuery.
+func (p *ExtractionPlan) estimateSteps(ctx context.Context, conn *db.Connection, g *graph.Graph, opts *TraversalOptions) error {
+	sets := make(map[string][]string)
+	for _, root := range p.Roots {
+		sets[root.Table] = append(sets[root.Table], root.Set)
+	}
+
+	for i := range p.Steps {
+		step := &p.Steps[i]
+
+		sources := make([]string, 0, len(sets[step.From]))
+		for _, set := range sets[step.From] {
+			sources = append(sources, fmt.Sprintf("SELECT %s FROM %s", strings.Join(step.FromColumns, ", "), set))
+		}
+		if len(sources) == 0 {
+			step.Skipped = fmt.Sprintf("no rows of %s are fetched", step.From)
+			continue
+		}
+
+		target := step.ToColumns[0]
+		if len(step.ToColumns) > 1 {
+			target = "(" + strings.Join(step.ToColumns, ", ") + ")"
+		}
+
+		condition := fmt.Sprintf("%s IN (%s)", target, strings.Join(sources, " UNION "))
+
+		step.Set = fmt.Sprintf("s%d", len(p.fetchSets))
+		if step.Direction == graph.DirectionDown {
+			remaining, ok := opts.TableLimits[step.To]
+			if !ok {
+				remaining = -1
+			}
+			step.Query = childQuery(g, opts, step.To, []string{"*"}, step.ToColumns, condition, remaining)
+		} else {
+			step.Query = fmt.Sprintf("SELECT * FROM %s WHERE %s", db.QuoteTable(step.To), condition)
+		}
+
+		// Placeholders of the root sets are numbered across the whole query
+		bound, args := bindParams(p.withSets(step.Query), p.Params)
+		estimate, err := conn.EstimateRows(ctx, bound, args...)
+		if err != nil {
+			return fmt.Errorf("failed to estimate %s -> %s via %s: %w", step.From, step.To, step.ForeignKey, err)
+		}
+		step.EstimatedRows = estimate
+
+		p.fetchSets = append(p.fetchSets, step.Query)
+		sets[step.To] = append(sets[step.To], step.Set)
+	}
+
+	return nil
+}
+
+// withSets prefixes query with the CTEs of all sets defined so far.
+func (p *ExtractionPlan) withSets(query string) string {
+	ctes := make([]string, len(p.fetchSets))
+	for i, body := range p.fetchSets {
+		ctes[i] = fmt.Sprintf("s%d AS (%s)", i, body)
+	}
+	return fmt.Sprintf("WITH %s %s", strings.Join(ctes, ", "), query)
+}
+
+// summarize computes the insert order and the per-table row estimates.
+func (p *ExtractionPlan) summarize(g *graph.Graph, tableRows map[string]int64) error {
+	estimates := make(map[string]int64)
+	for _, root := range p.Roots {
+		estimates[root.Table] += root.EstimatedRows
+	}
+	for _, step := range p.Steps {
+		if step.Skipped == "" {
+			estimates[step.To] += step.EstimatedRows
+		}
+	}
+
+	tables := make([]string, 0, len(estimates))
+	for table := range estimates {
+		tables = append(tables, table)
+	}
+
+	insertPlan, err := g.PlanInserts(tables)
+	if err != nil {
+		return fmt.Errorf("failed to sort tables: %w", err)
+	}
+
+	p.InsertOrder = insertPlan.Order
+	for _, fk := range insertPlan.Deferred {
+		p.Deferred = append(p.Deferred, fk.Name)
+	}
+	for _, fk := range insertPlan.Postponed {
+		p.Postponed = append(p.Postponed, fk.Name)
+	}
+
+	for _, table := range p.InsertOrder {
+		total, ok := tableRows[table]
+		if !ok {
+			total = -1
+		}
+
+		estimate := estimates[table]
+		if total >= 0 && estimate > total {
+			estimate = total
+		}
+
+		p.Tables = append(p.Tables, TablePlan{Name: table, TableRows: total, EstimatedRows: estimate})
+		p.EstimatedRows += estimate
+	}
+
+	return nil
+}
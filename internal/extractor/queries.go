@@ -0,0 +1,188 @@
+package extractor
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SplitStatements splits SQL text, such as a --queries-file, into statements
+// on semicolons. Semicolons inside quoted strings and identifiers, dollar-quoted
+// strings and comments do not end a statement. Statements are trimmed, without
+// their semicolon and any trailing comment; empty and comment-only statements
+// are dropped.
+func SplitStatements(sql string) []string {
+	statements := make([]string, 0)
+	start := 0
+	codeEnd := -1 // End of the current statement's last token, -1 if it has none
+
+	end := func(i int) {
+		if codeEnd >= 0 {
+			statements = append(statements, strings.TrimSpace(sql[start:codeEnd]))
+		}
+		start = i + 1
+		codeEnd = -1
+	}
+
+	scanTokens(sql, func(tokenStart, tokenEnd int) {
+		if sql[tokenStart] == ';' {
+			end(tokenStart)
+		} else {
+			codeEnd = tokenEnd
+		}
+	})
+	end(len(sql))
+
+	return statements
+}
+
+// maxPlaceholder returns the highest n of the $n parameter placeholders in
+// sql, or 0 if it has none.
+func maxPlaceholder(sql string) int {
+	highest := 0
+	scanTokens(sql, func(start, end int) {
+		if sql[start] != '$' || (start > 0 && isIdentifierChar(sql[start-1])) {
+			return
+		}
+
+		n := 0
+		for i := end; i < len(sql) && sql[i] >= '0' && sql[i] <= '9'; i++ {
+			n = n*10 + int(sql[i]-'0')
+		}
+		highest = max(highest, n)
+	})
+	return highest
+}
+
+// checkParentheses checks that the parentheses of sql, outside strings and
+// comments, are balanced. Predicates are spliced into generated queries
+// wrapped in parentheses, which an unbalanced predicate such as
+// "true) OR (true" could close to change the meaning of the query.
+func checkParentheses(sql string) error {
+	depth := 0
+	balanced := true
+	scanTokens(sql, func(start, end int) {
+		switch sql[start] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			balanced = balanced && depth >= 0
+		}
+	})
+
+	if !balanced || depth != 0 {
+		return fmt.Errorf("unbalanced parentheses in '%s'", sql)
+	}
+	return nil
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c == '$' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+// scanTokens calls visit with the start and end of every token of sql outside
+// comments and whitespace. Quoted strings and identifiers and dollar-quoted
+// strings are single tokens; any other character is a token of its own. The E
+// prefix of an escape string (E'it\'s') is a token before its string.
+func scanTokens(sql string, visit func(start, end int)) {
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		start := i
+		switch {
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			if j := strings.IndexByte(sql[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = len(sql)
+			}
+			continue
+
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			i = blockCommentEnd(sql, i)
+			continue
+
+		case unicode.IsSpace(rune(c)):
+			continue
+
+		case c == '\'' || c == '"':
+			i = quotedEnd(sql, i, c, c == '\'' && isEscapeString(sql, i))
+
+		case c == '$':
+			if tag, ok := dollarTag(sql[i:]); ok {
+				if j := strings.Index(sql[i+len(tag):], tag); j >= 0 {
+					i += len(tag) + j + len(tag) - 1
+				} else {
+					i = len(sql)
+				}
+			}
+		}
+		visit(start, min(i+1, len(sql)))
+	}
+}
+
+// isEscapeString reports whether the string opened at sql[start] is an escape
+// string: its quote follows an E that does not end a longer identifier.
+func isEscapeString(sql string, start int) bool {
+	if start == 0 || (sql[start-1] != 'E' && sql[start-1] != 'e') {
+		return false
+	}
+	return start == 1 || !isIdentifierChar(sql[start-2])
+}
+
+// quotedEnd returns the position of the quote closing the string or identifier
+// opened at sql[start]. Doubled quotes are escapes, as are backslashes if
+// backslashEscapes is set.
+func quotedEnd(sql string, start int, quote byte, backslashEscapes bool) int {
+	for i := start + 1; i < len(sql); i++ {
+		if backslashEscapes && sql[i] == '\\' {
+			i++
+			continue
+		}
+		if sql[i] != quote {
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == quote {
+			i++
+			continue
+		}
+		return i
+	}
+	return len(sql)
+}
+
+// blockCommentEnd returns the position of the last character of the block
+// comment opened at sql[start]. Block comments nest, as in PostgreSQL.
+func blockCommentEnd(sql string, start int) int {
+	depth := 0
+	for i := start; i < len(sql)-1; i++ {
+		switch sql[i : i+2] {
+		case "/*":
+			depth++
+			i++
+		case "*/":
+			depth--
+			i++
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(sql)
+}
+
+// dollarTag returns the dollar-quote delimiter ($$ or $tag$) sql starts with,
+// if any. A "$" followed by digits is a positional parameter, not a quote.
+func dollarTag(sql string) (string, bool) {
+	for i := 1; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '$':
+			return sql[:i+1], true
+		case c == '_' || unicode.IsLetter(rune(c)) || (i > 1 && unicode.IsDigit(rune(c))):
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
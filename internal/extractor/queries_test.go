@@ -0,0 +1,140 @@
+package extractor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "statements",
+			sql:  "SELECT 1; SELECT 2",
+			want: []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name: "trailing semicolons and blank statements",
+			sql:  "SELECT 1;\n;  ;\nSELECT 2;\n",
+			want: []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name: "quoted string",
+			sql:  "SELECT 'a;b' FROM t; SELECT 2",
+			want: []string{"SELECT 'a;b' FROM t", "SELECT 2"},
+		},
+		{
+			name: "doubled quote",
+			sql:  "SELECT 'it''s;' FROM t; SELECT 2",
+			want: []string{"SELECT 'it''s;' FROM t", "SELECT 2"},
+		},
+		{
+			name: "quoted identifier",
+			sql:  `SELECT "a;""b" FROM t; SELECT 2`,
+			want: []string{`SELECT "a;""b" FROM t`, "SELECT 2"},
+		},
+		{
+			name: "escape string",
+			sql:  `SELECT E'it\'s;' FROM t; SELECT 2`,
+			want: []string{`SELECT E'it\'s;' FROM t`, "SELECT 2"},
+		},
+		{
+			name: "lowercase escape string with escaped backslash",
+			sql:  `SELECT e'a\\'; SELECT 2`,
+			want: []string{`SELECT e'a\\'`, "SELECT 2"},
+		},
+		{
+			name: "backslash in a standard string",
+			sql:  `SELECT 'a\'; SELECT 2`,
+			want: []string{`SELECT 'a\'`, "SELECT 2"},
+		},
+		{
+			name: "identifier ending in e",
+			sql:  `SELECT name'a\'; SELECT 2`,
+			want: []string{`SELECT name'a\'`, "SELECT 2"},
+		},
+		{
+			name: "dollar quotes",
+			sql:  "SELECT $$a;b$$, $tag$c;$$;d$tag$ FROM t; SELECT 2",
+			want: []string{"SELECT $$a;b$$, $tag$c;$$;d$tag$ FROM t", "SELECT 2"},
+		},
+		{
+			name: "placeholder is not a dollar quote",
+			sql:  "SELECT * FROM t WHERE id = $1; SELECT $2",
+			want: []string{"SELECT * FROM t WHERE id = $1", "SELECT $2"},
+		},
+		{
+			name: "line comments",
+			sql:  "-- first; query\nSELECT 1 -- one;\n; SELECT 2 -- two",
+			want: []string{"-- first; query\nSELECT 1", "SELECT 2"},
+		},
+		{
+			name: "nested block comments",
+			sql:  "SELECT /* a /* b; */ c; */ 1; SELECT 2",
+			want: []string{"SELECT /* a /* b; */ c; */ 1", "SELECT 2"},
+		},
+		{
+			name: "comment-only statements",
+			sql:  "-- nothing\n; /* nothing */;",
+			want: []string{},
+		},
+		{
+			name: "unterminated string",
+			sql:  "SELECT 1; SELECT 'a;b",
+			want: []string{"SELECT 1", "SELECT 'a;b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitStatements(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitStatements(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxPlaceholder(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want int
+	}{
+		{sql: "SELECT 1", want: 0},
+		{sql: "SELECT $1", want: 1},
+		{sql: "SELECT * FROM t WHERE a = $2 AND b = $10", want: 10},
+		{sql: "SELECT '$3', \"$4\", $$ $5 $$ -- $6\n/* $7 */", want: 0},
+		{sql: "SELECT $tag$ $8 $tag$, $1", want: 1},
+		{sql: "SELECT a$2 FROM t", want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := maxPlaceholder(tt.sql); got != tt.want {
+			t.Errorf("maxPlaceholder(%q) = %d, want %d", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestCheckParentheses(t *testing.T) {
+	tests := []struct {
+		sql     string
+		wantErr bool
+	}{
+		{sql: "deleted_at IS NULL"},
+		{sql: "(a = 1 OR b = 2) AND c IN (SELECT id FROM t WHERE (x))"},
+		{sql: "name <> ')' AND \"odd)\" = 1 -- )\n/* ( */"},
+		{sql: "body = $$)$$"},
+		{sql: "true) OR (true", wantErr: true},
+		{sql: "a = 1)", wantErr: true},
+		{sql: "(a = 1", wantErr: true},
+		{sql: ") (", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := checkParentheses(tt.sql); (err != nil) != tt.wantErr {
+			t.Errorf("checkParentheses(%q) = %v, want error %v", tt.sql, err, tt.wantErr)
+		}
+	}
+}
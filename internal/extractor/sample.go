@@ -0,0 +1,56 @@
+package extractor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sampleHashBits is the width of the hash ranking sampled rows; it fits in a
+// non-negative bigint.
+const sampleHashBits = 60
+
+// Sample selects a deterministic subset of the rows of each root query. Rows
+// are ranked by a hash of Seed and their key (or whole row, for keyless
+// tables), so the same seed always selects the same rows of the same data,
+// independently of their physical order.
+type Sample struct {
+	Fraction float64 `json:"fraction,omitempty"` // Keep this fraction of the rows (0 to 1), if Rows is 0
+	Rows     int     `json:"rows,omitempty"`     // Keep this many rows per root query
+	Seed     int64   `json:"seed"`
+}
+
+// ParseSamplePercent parses a --sample value such as "0.5%" or "10" into a
+// fraction of the rows.
+func ParseSamplePercent(value string) (float64, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return 0, fmt.Errorf("invalid sample '%s' (expected a percentage above 0 and up to 100, e.g. 0.5%%)", value)
+	}
+	return percent / 100, nil
+}
+
+// hash returns the SQL expression ranking a row whose identity is the text
+// expression input.
+func (s *Sample) hash(input string) string {
+	return fmt.Sprintf("('x' || substr(md5('%d:' || %s), 1, %d))::bit(%d)::bigint",
+		s.Seed, input, sampleHashBits/4, sampleHashBits)
+}
+
+// clause returns the WHERE, or ORDER BY and LIMIT, clause keeping the sampled
+// rows of a query whose row identity is the text expression input. It returns
+// an empty string if s is nil.
+func (s *Sample) clause(input string) string {
+	if s == nil {
+		return ""
+	}
+
+	hash := s.hash(input)
+	if s.Rows > 0 {
+		// Rows with equal hashes are ordered by identity, so ties are stable too
+		return fmt.Sprintf(" ORDER BY %s, %s LIMIT %d", hash, input, s.Rows)
+	}
+
+	threshold := int64(s.Fraction * (1 << sampleHashBits))
+	return fmt.Sprintf(" WHERE %s < %d", hash, threshold)
+}
@@ -0,0 +1,80 @@
+package extractor
+
+import (
+	"testing"
+)
+
+func TestParseSamplePercent(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{value: "100%", want: 1},
+		{value: "100", want: 1},
+		{value: "10%", want: 0.1},
+		{value: " 0.5% ", want: 0.005},
+		{value: "0%", wantErr: true},
+		{value: "0", wantErr: true},
+		{value: "-1%", wantErr: true},
+		{value: "100.5%", wantErr: true},
+		{value: "half", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSamplePercent(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSamplePercent(%q) = %v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSamplePercent(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestSampleClause(t *testing.T) {
+	const hash = "('x' || substr(md5('42:' || id), 1, 15))::bit(60)::bigint"
+
+	tests := []struct {
+		name   string
+		sample *Sample
+		want   string
+	}{
+		{name: "no sample", sample: nil, want: ""},
+		{name: "0%", sample: &Sample{Fraction: 0, Seed: 42}, want: " WHERE " + hash + " < 0"},
+		{name: "100%", sample: &Sample{Fraction: 1, Seed: 42}, want: " WHERE " + hash + " < 1152921504606846976"},
+		{name: "0.5%", sample: &Sample{Fraction: 0.005, Seed: 42}, want: " WHERE " + hash + " < 5764607523034235"},
+		{name: "rows", sample: &Sample{Rows: 1000, Seed: 42}, want: " ORDER BY " + hash + ", id LIMIT 1000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sample.clause("id"); got != tt.want {
+				t.Errorf("clause() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampleKeyQuery(t *testing.T) {
+	q := &QueryInfo{
+		Query: "SELECT tenant_id, id FROM orders",
+		Seeds: []Seed{{Table: "public.orders", Columns: []string{"tenant_id", "id"}}},
+	}
+
+	if got, want := q.keyQuery(nil), "SELECT \"tenant_id\", \"id\" FROM (SELECT tenant_id, id FROM orders\n) AS root"; got != want {
+		t.Errorf("keyQuery(nil) =\n%s\nwant\n%s", got, want)
+	}
+
+	// A composite key is hashed as one row value, after removing duplicate keys
+	got := q.keyQuery(&Sample{Fraction: 0.25, Seed: 7})
+	want := "SELECT \"tenant_id\", \"id\" FROM (SELECT DISTINCT \"tenant_id\", \"id\" FROM (SELECT tenant_id, id FROM orders\n) AS root\n) AS root" +
+		` WHERE ('x' || substr(md5('7:' || ROW("tenant_id", "id")::text), 1, 15))::bit(60)::bigint < 288230376151711744`
+	if got != want {
+		t.Errorf("keyQuery(sample) =\n%s\nwant\n%s", got, want)
+	}
+}
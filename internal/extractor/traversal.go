@@ -6,12 +6,14 @@ package extractor
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/riyasyash/pg_rocket/internal/db"
 	"github.com/riyasyash/pg_rocket/internal/graph"
+	"github.com/riyasyash/pg_rocket/internal/storage"
 )
 
 // BatchSize defines the number of rows to fetch in a single query
@@ -20,444 +22,532 @@ const BatchSize = 500
 
 // TraversalOptions configures the behavior of the data extraction traversal.
 type TraversalOptions struct {
-	ParentsOnly      bool     // Only traverse upward to parent records
-	ChildrenOnly     bool     // Only traverse downward to child records
-	SelectedChildren []string // Specific child tables to traverse (nil means all)
-	MaxRows          int      // Maximum number of rows to extract
-	Force            bool     // Override MaxRows limit
-	Verbose          bool     // Enable detailed logging
+	ParentsOnly      bool                  // Only traverse upward to parent records
+	ChildrenOnly     bool                  // Only traverse downward to child records
+	SelectedChildren []string              // Specific child tables to traverse (nil means all)
+	MaxParentDepth   int                   // Maximum FK hops followed upward from each table (-1 means unlimited)
+	MaxChildDepth    int                   // Maximum FK hops followed downward from the root table (-1 means unlimited)
+	TableLimits      map[string]int        // Maximum rows fetched per table by child traversal
+	ChildLimits      map[string]ChildLimit // Maximum child rows fetched per parent row, by child table
+	Filters          map[string][]string   // SQL predicates child rows must satisfy, by child table
+	ExcludedTables   []string              // Tables never traversed into, in either direction
+	ExcludedEdges    []ExcludedEdge        // Foreign keys never followed, in either direction
+	Parallelism      int                   // Maximum fetch queries run concurrently (values below 1 mean 1)
+	SpillDir         string                // Directory for spilling rows to disk (empty keeps all rows in memory)
+	SeedTables       []string              // Tables join root queries select by their plain key columns
+	Params           []QueryParam          // Values bound to the placeholders of the root queries
+	Sample           *Sample               // Subset of the rows of each root query to keep (nil keeps all)
+	MaxRows          int                   // Maximum number of rows to extract
+	Force            bool                  // Override MaxRows limit
+	Verbose          bool                  // Enable detailed logging
 }
 
 // TraversalState maintains the state of an ongoing data extraction traversal.
 // It tracks visited rows, collected data, and provides access to the database
 // connection and FK graph.
 type TraversalState struct {
-	VisitedRows map[string]map[interface{}]bool     // Tracks visited rows by table and PK
-	TableData   map[string][]map[string]interface{} // Collected data by table
-	RowCount    int                                 // Total rows extracted
-	Graph       *graph.Graph                        // Foreign key graph
-	Connection  *db.Connection                      // Database connection pool
-	Options     *TraversalOptions                   // Traversal configuration
-	Progress    *ProgressTracker                    // Progress reporting
+	Rows       storage.Store     // Collected rows by table, deduplicated by row identity
+	RowCount   int               // Total rows extracted
+	Graph      *graph.Graph      // Foreign key graph
+	Connection *db.Connection    // Database connection pool
+	Options    *TraversalOptions // Traversal configuration
+	Progress   *ProgressTracker  // Progress reporting
+
+	queriers []db.Querier          // Snapshot transactions of the fetch workers, see Extract
+	depths   map[string][]rowDepth // Depth of each row, by position in Rows
+	cursors  map[string]int        // Rows of the source table already followed along each edge
+	upgraded map[string][]int      // Rows that became eligible for child traversal after being fetched as parents
+	limited  map[string]bool       // Tables whose --table-limit was reported as reached
+}
+
+// rowDepth records how a row was reached, in FK hops.
+type rowDepth struct {
+	child  int // Hops from the root via child foreign keys, or -1 if the row was fetched as a parent
+	parent int // Hops from the nearest root or child row via parent foreign keys
 }
 
 // NewTraversalState creates a new traversal state with the given graph, connection, and options.
-func NewTraversalState(g *graph.Graph, conn *db.Connection, opts *TraversalOptions) *TraversalState {
-	return &TraversalState{
-		VisitedRows: make(map[string]map[interface{}]bool),
-		TableData:   make(map[string][]map[string]interface{}),
-		RowCount:    0,
-		Graph:       g,
-		Connection:  conn,
-		Options:     opts,
-		Progress:    NewProgressTracker(opts.Verbose),
+// Rows are kept in memory, or spilled to files under opts.SpillDir if it is
+// set. The caller must Close the state to release them.
+func NewTraversalState(g *graph.Graph, conn *db.Connection, opts *TraversalOptions) (*TraversalState, error) {
+	var rows storage.Store = storage.NewMemoryStore(g.GetRowKeyColumns)
+	if opts.SpillDir != "" {
+		disk, err := storage.NewDiskStore(opts.SpillDir, g.GetRowKeyColumns, storage.DefaultSegmentRows)
+		if err != nil {
+			return nil, err
+		}
+		rows = disk
 	}
+
+	return &TraversalState{
+		Rows:       rows,
+		RowCount:   0,
+		Graph:      g,
+		Connection: conn,
+		Options:    opts,
+		Progress:   NewProgressTracker(opts.Verbose),
+		depths:     make(map[string][]rowDepth),
+		cursors:    make(map[string]int),
+		upgraded:   make(map[string][]int),
+		limited:    make(map[string]bool),
+	}, nil
 }
 
-// Extract performs the main data extraction starting from the given query.
-// It executes the root query, then traverses parent and/or child relationships
-// based on the configured options. Returns an error if traversal fails or
-// row limits are exceeded.
-func (ts *TraversalState) Extract(ctx context.Context, queryInfo *QueryInfo) error {
+// Close releases the stored rows, removing any spill files.
+func (ts *TraversalState) Close() error {
+	return ts.Rows.Close()
+}
+
+// Extract performs the main data extraction starting from the given root
+// queries. After the root queries, foreign keys are followed from every newly added row
+// until no new rows appear: parent foreign keys from all rows, and child
+// foreign keys from the root rows and rows fetched as children. The result is
+// closed under the parent relation (within the configured depth limits and
+// exclusions). All queries run in one REPEATABLE READ READ ONLY snapshot,
+// shared by the fetch workers, so concurrent writes to the source database
+// cannot leave a fetched row without its parent. Returns an error if traversal
+// fails or row limits are exceeded.
+func (ts *TraversalState) Extract(ctx context.Context, roots []*QueryInfo) error {
 	ts.Progress.StartPhase("Data Extraction")
-	ts.Progress.Info("Starting from table: %s", queryInfo.BaseTable)
 
-	if err := ts.executeRootQuery(ctx, queryInfo); err != nil {
+	snapshot, err := ts.Connection.BeginSnapshot(ctx)
+	if err != nil {
 		return err
 	}
+	defer snapshot.Close(ctx)
 
-	// Track which tables we've already processed parents for
-	processedParents := make(map[string]bool)
-
-	if !ts.Options.ChildrenOnly {
-		ts.Progress.Info("Traversing parent relationships...")
-		if err := ts.traverseParents(ctx, queryInfo.BaseTable); err != nil {
+	// Each worker needs its own connection; they import the snapshot
+	ts.queriers = []db.Querier{snapshot}
+	for len(ts.queriers) < ts.Options.Parallelism {
+		querier, err := snapshot.Share(ctx)
+		if err != nil {
 			return err
 		}
-		processedParents[queryInfo.BaseTable] = true
+		ts.queriers = append(ts.queriers, querier)
 	}
 
-	if !ts.Options.ParentsOnly {
-		ts.Progress.Info("Traversing child relationships...")
-		if err := ts.traverseChildren(ctx, queryInfo.BaseTable); err != nil {
+	// Roots share the visited rows, so a row selected by several roots, or
+	// reached from one root and selected by another, is extracted once
+	for _, queryInfo := range roots {
+		ts.Progress.Info("Starting from table: %s", strings.Join(queryInfo.Tables(), ", "))
+		if err := ts.executeRootQuery(ctx, queryInfo); err != nil {
 			return err
 		}
+	}
 
-		// After traversing children, traverse parents of ALL newly discovered child tables
-		// This ensures we get configuration/reference tables that child tables reference
-		if !ts.Options.ChildrenOnly {
-			for tableName := range ts.TableData {
-				if !processedParents[tableName] && tableName != queryInfo.BaseTable {
-					ts.Progress.Info("Traversing parents of discovered table: %s", tableName)
-					if err := ts.traverseParents(ctx, tableName); err != nil {
-						return err
-					}
-					processedParents[tableName] = true
+	// Rows added during a round are followed in the next one, so rows are
+	// reached in breadth-first order and row depths count FK hops
+	for round := 1; ; round++ {
+		end := make(map[string]int)
+		for _, tableName := range ts.Rows.Tables() {
+			end[tableName] = ts.Rows.Len(tableName)
+		}
+		upgraded := ts.upgraded
+		ts.upgraded = make(map[string][]int)
+
+		tables := make([]string, 0, len(end))
+		for tableName := range end {
+			tables = append(tables, tableName)
+		}
+		sort.Strings(tables)
+
+		ts.Progress.Info("Traversal round %d", round)
+		rowCount := ts.RowCount
+
+		err := ts.runTasks(ctx, func(emit func(fetchTask) error) error {
+			for _, tableName := range tables {
+				if err := ts.traverseTable(tableName, end[tableName], upgraded[tableName], emit); err != nil {
+					return err
 				}
 			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if ts.RowCount == rowCount && len(ts.upgraded) == 0 {
+			break
 		}
 	}
 
-	ts.Progress.Complete(ts.RowCount, len(ts.TableData))
+	ts.Progress.Complete(ts.RowCount, len(ts.Rows.Tables()))
 
 	return nil
 }
 
+// executeRootQuery runs a root query and fetches the full rows of its seed
+// tables by the keys it projects, batched like parent rows. Keys with a NULL
+// component, e.g. from an outer join, select nothing. With --sample, only the
+// sampled rows of the query are kept.
 func (ts *TraversalState) executeRootQuery(ctx context.Context, queryInfo *QueryInfo) error {
-	// Get column info to detect JSONB columns
-	columnQuery := `
-		SELECT column_name, data_type
-		FROM information_schema.columns
-		WHERE table_schema = 'public' 
-		  AND table_name = $1
-		ORDER BY ordinal_position
-	`
-
-	colRows, err := ts.Connection.Pool.Query(ctx, columnQuery, queryInfo.BaseTable)
-	if err != nil {
-		return fmt.Errorf("failed to get column info for %s: %w", queryInfo.BaseTable, err)
-	}
-
-	jsonbCols := make(map[string]bool)
-	hasJSONB := false
-	for colRows.Next() {
-		var colName, dataType string
-		if err := colRows.Scan(&colName, &dataType); err != nil {
-			colRows.Close()
-			return fmt.Errorf("failed to scan column info: %w", err)
-		}
-		if dataType == "jsonb" || dataType == "json" {
-			jsonbCols[colName] = true
-			hasJSONB = true
-		}
-	}
-	colRows.Close()
-
-	// If there are JSONB columns and the query is SELECT *, rewrite it
-	var queryToRun string
-	if hasJSONB && strings.Contains(strings.ToUpper(queryInfo.Query), "SELECT *") {
-		// Get all columns and build a query with JSONB casts
-		allCols, err := ts.Connection.Pool.Query(ctx, columnQuery, queryInfo.BaseTable)
+	// Keyless rows cannot be fetched again, so the query returns them whole;
+	// it is wrapped to read them with the same column handling as other fetches
+	if seed := queryInfo.Seeds[0]; len(seed.Columns) == 0 {
+		selectCols, err := ts.selectColumns(seed.Table)
 		if err != nil {
-			return fmt.Errorf("failed to get columns: %w", err)
-		}
-
-		var selectCols []string
-		for allCols.Next() {
-			var colName, dataType string
-			if err := allCols.Scan(&colName, &dataType); err != nil {
-				allCols.Close()
-				return fmt.Errorf("failed to scan column: %w", err)
-			}
-
-			if dataType == "jsonb" || dataType == "json" {
-				selectCols = append(selectCols, fmt.Sprintf("%s::text AS %s", colName, colName))
-			} else {
-				selectCols = append(selectCols, colName)
-			}
+			return err
 		}
-		allCols.Close()
 
-		// Replace SELECT * with explicit column list
-		queryToRun = strings.Replace(queryInfo.Query, "SELECT *",
-			fmt.Sprintf("SELECT %s", strings.Join(selectCols, ", ")), 1)
-		queryToRun = strings.Replace(queryToRun, "select *",
-			fmt.Sprintf("SELECT %s", strings.Join(selectCols, ", ")), 1)
-	} else {
-		queryToRun = queryInfo.Query
+		query, args := queryInfo.bind(queryInfo.rowsQuery(selectCols, ts.Options.Sample))
+		return ts.runTasks(ctx, func(emit func(fetchTask) error) error {
+			return emit(fetchTask{table: seed.Table, query: query, args: args})
+		})
 	}
 
-	// Execute the (possibly rewritten) query
-	rows, err := ts.Connection.Pool.Query(ctx, queryToRun)
+	query, args := queryInfo.bind(queryInfo.keyQuery(ts.Options.Sample))
+	rows, err := ts.queriers[0].Query(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("failed to execute root query: %w", err)
 	}
-	defer rows.Close()
-
-	// If there are JSONB columns, process with JSONB info
-	if hasJSONB {
-		return ts.processRowsWithJSONBInfo(ctx, rows, queryInfo.BaseTable, jsonbCols)
+	result, err := scanRows(rows)
+	rows.Close()
+	if err != nil {
+		return err
 	}
 
-	return ts.processRows(ctx, rows, queryInfo.BaseTable)
+	return ts.runTasks(ctx, func(emit func(fetchTask) error) error {
+		for _, seed := range queryInfo.Seeds {
+			err := ts.keyTasks(seed.Table, ts.Graph.GetRowKeyColumns(seed.Table), keyTuples(result, seed.Columns), rowDepth{}, emit)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (ts *TraversalState) processRows(ctx context.Context, rows pgx.Rows, tableName string) error {
+// scanRows reads all rows of a query result into column maps. JSONB/JSON
+// columns arrive cast to text and are stored as-is; they are cast back during
+// insertion.
+func scanRows(rows pgx.Rows) ([]map[string]interface{}, error) {
 	fieldDescriptions := rows.FieldDescriptions()
-	pkColumns := ts.Graph.GetPrimaryKeyColumns(tableName)
-
-	if ts.VisitedRows[tableName] == nil {
-		ts.VisitedRows[tableName] = make(map[interface{}]bool)
-	}
-
-	newRows := make([]map[string]interface{}, 0)
+	result := make([]map[string]interface{}, 0)
 
 	for rows.Next() {
 		values, err := rows.Values()
 		if err != nil {
-			return fmt.Errorf("failed to scan row: %w", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
 		rowMap := make(map[string]interface{})
-		pkValues := make([]interface{}, 0, len(pkColumns))
 
 		for i, value := range values {
 			colName := string(fieldDescriptions[i].Name)
 			rowMap[colName] = value
-
-			// Collect values for all PK columns
-			for _, pkCol := range pkColumns {
-				if colName == pkCol {
-					pkValues = append(pkValues, value)
-				}
-			}
 		}
 
-		if len(pkValues) != len(pkColumns) {
-			return fmt.Errorf("primary key value(s) missing in table %s", tableName)
-		}
+		result = append(result, rowMap)
+	}
 
-		// Create composite PK key (for single PKs, this is just the single value)
-		var pkKey interface{}
-		if len(pkValues) == 1 {
-			pkKey = pkValues[0]
-		} else {
-			// For composite PKs, create a string key
-			pkKey = fmt.Sprintf("%v", pkValues)
+	return result, rows.Err()
+}
+
+// addRows adds the fetched rows of task's table that were not visited before,
+// recording the task's depth for each. A visited row fetched as a parent that
+// is now reached as a child becomes eligible for child traversal. Child
+// fetches stop adding rows once the table's --table-limit is reached.
+func (ts *TraversalState) addRows(task fetchTask, rows []map[string]interface{}) error {
+	tableName, depth := task.table, task.depth
+	pkColumns := ts.Graph.GetRowKeyColumns(tableName)
+
+	added := 0
+
+	for _, rowMap := range rows {
+		ts.nullExcluded(tableName, rowMap)
+
+		pkKey, err := rowIdentity(rowMap, pkColumns, tableName)
+		if err != nil {
+			return err
 		}
 
-		if pkKey == nil {
-			return fmt.Errorf("primary key value is NULL in table %s", tableName)
+		index, visited, err := ts.Rows.Lookup(tableName, pkKey)
+		if err != nil {
+			return err
+		}
+		if visited {
+			// As a child row its parent hops count from itself again, so the
+			// depth of the parent path that reached it first is replaced
+			if depth.child >= 0 && ts.depths[tableName][index].child < 0 {
+				ts.depths[tableName][index] = depth
+				ts.upgraded[tableName] = append(ts.upgraded[tableName], index)
+			}
+			continue
 		}
 
-		if ts.VisitedRows[tableName][pkKey] {
+		// Batches fetched concurrently each read up to the limit left when
+		// they were built; keep the first rows in task order
+		if task.limited && ts.remainingRows(tableName) == 0 {
 			continue
 		}
 
-		ts.VisitedRows[tableName][pkKey] = true
-		newRows = append(newRows, rowMap)
+		if _, err := ts.Rows.Add(tableName, pkKey, rowMap); err != nil {
+			return err
+		}
+		ts.depths[tableName] = append(ts.depths[tableName], depth)
 		ts.RowCount++
+		added++
 
 		if !ts.Options.Force && ts.RowCount > ts.Options.MaxRows {
 			return fmt.Errorf("row limit exceeded (%d rows). Use --force to override", ts.Options.MaxRows)
 		}
 	}
 
-	if len(newRows) > 0 {
-		ts.TableData[tableName] = append(ts.TableData[tableName], newRows...)
-		ts.Progress.TableDiscovered(tableName, len(newRows))
+	if added > 0 {
+		ts.Progress.TableDiscovered(tableName, added)
 		ts.Progress.Progress(ts.RowCount, ts.Options.MaxRows,
 			fmt.Sprintf("Extracting data (%d/%d rows)", ts.RowCount, ts.Options.MaxRows))
 	}
 
-	return rows.Err()
+	return nil
 }
 
-// processRowsWithJSONBInfo processes rows where JSONB/JSON columns have been cast to text
-func (ts *TraversalState) processRowsWithJSONBInfo(ctx context.Context, rows pgx.Rows, tableName string, jsonbCols map[string]bool) error {
-	fieldDescriptions := rows.FieldDescriptions()
-	pkColumns := ts.Graph.GetPrimaryKeyColumns(tableName)
-
-	if ts.VisitedRows[tableName] == nil {
-		ts.VisitedRows[tableName] = make(map[interface{}]bool)
-	}
-
-	newRows := make([]map[string]interface{}, 0)
+// withinDepth reports whether foreign keys may be followed from a row at the
+// given depth without exceeding maxDepth. A negative maxDepth means unlimited.
+func withinDepth(depth, maxDepth int) bool {
+	return maxDepth < 0 || depth < maxDepth
+}
 
-	for rows.Next() {
-		values, err := rows.Values()
-		if err != nil {
-			return fmt.Errorf("failed to scan row: %w", err)
-		}
+// traverseTable passes to emit the fetches following the foreign keys of
+// tableName from the rows not yet followed along each edge, up to row index
+// end. Rows in upgraded became eligible for child traversal after the child
+// edges had passed them, and had their parent depth reset. Rows are read back
+// from the store in batches, keeping only their foreign key values, so a
+// table is never held in memory whole.
+func (ts *TraversalState) traverseTable(tableName string, end int, upgraded []int, emit func(fetchTask) error) error {
+	if !ts.Options.ChildrenOnly {
+		for _, fk := range ts.Graph.GetParents(tableName) {
+			// Columns referencing excluded parents were nulled at ingest where possible
+			if ts.Options.Excludes(fk) {
+				continue
+			}
 
-		rowMap := make(map[string]interface{})
-		pkValues := make([]interface{}, 0, len(pkColumns))
+			start := ts.advanceCursor(graph.DirectionUp, fk, end)
 
-		for i, value := range values {
-			colName := string(fieldDescriptions[i].Name)
+			// Upgraded rows may now be within --max-parent-depth where their
+			// old depth was not; their other parents are deduplicated
+			indices := rowRange(start, end)
+			if ts.Options.MaxParentDepth >= 0 {
+				for _, index := range upgraded {
+					if index < start {
+						indices = append(indices, index)
+					}
+				}
+			}
+			if len(indices) == 0 {
+				continue
+			}
 
-			// JSONB columns are now text (from our ::text cast)
-			// Store as-is - will be cast back to JSONB during insertion
-			rowMap[colName] = value
+			ts.Progress.TraversingTable(tableName, "parents")
 
-			// Collect values for all PK columns
-			for _, pkCol := range pkColumns {
-				if colName == pkCol {
-					pkValues = append(pkValues, value)
+			depths, groups := ts.depthGroups(tableName, indices, func(d rowDepth) int { return d.parent }, ts.Options.MaxParentDepth)
+			for _, depth := range depths {
+				err := ts.keyBatches(tableName, groups[depth], fk.ChildColumns, func(keys [][]interface{}) error {
+					return ts.parentTasks(fk, keys, rowDepth{child: -1, parent: depth + 1}, emit)
+				})
+				if err != nil {
+					return err
 				}
 			}
 		}
+	}
 
-		if len(pkValues) != len(pkColumns) {
-			return fmt.Errorf("primary key value(s) missing in table %s", tableName)
-		}
+	if ts.Options.ParentsOnly {
+		return nil
+	}
 
-		// Create composite PK key
-		var pkKey interface{}
-		if len(pkValues) == 1 {
-			pkKey = pkValues[0]
-		} else {
-			pkKey = fmt.Sprintf("%v", pkValues)
-		}
+	selectedChildrenMap := make(map[string]bool)
+	for _, child := range ts.Options.SelectedChildren {
+		selectedChildrenMap[child] = true
+	}
 
-		if pkKey == nil {
-			return fmt.Errorf("primary key value is NULL in table %s", tableName)
+	for _, fk := range ts.Graph.GetChildren(tableName) {
+		if len(selectedChildrenMap) > 0 && !selectedChildrenMap[fk.ChildTable] {
+			continue
 		}
-
-		if ts.VisitedRows[tableName][pkKey] {
+		if ts.Options.Excludes(fk) {
 			continue
 		}
 
-		ts.VisitedRows[tableName][pkKey] = true
-		newRows = append(newRows, rowMap)
-		ts.RowCount++
+		start := ts.advanceCursor(graph.DirectionDown, fk, end)
 
-		if !ts.Options.Force && ts.RowCount > ts.Options.MaxRows {
-			return fmt.Errorf("row limit exceeded (%d rows). Use --force to override", ts.Options.MaxRows)
+		indices := rowRange(start, end)
+		for _, index := range upgraded {
+			if index < start {
+				indices = append(indices, index)
+			}
+		}
+		if len(indices) == 0 {
+			continue
 		}
-	}
-
-	if len(newRows) > 0 {
-		ts.TableData[tableName] = append(ts.TableData[tableName], newRows...)
-		ts.Progress.TableDiscovered(tableName, len(newRows))
-		ts.Progress.Progress(ts.RowCount, ts.Options.MaxRows,
-			fmt.Sprintf("Extracting data (%d/%d rows)", ts.RowCount, ts.Options.MaxRows))
-	}
-
-	return rows.Err()
-}
-
-func (ts *TraversalState) traverseParents(ctx context.Context, startTable string) error {
-	queue := []string{startTable}
-	processed := make(map[string]bool)
-
-	for len(queue) > 0 {
-		currentTable := queue[0]
-		queue = queue[1:]
 
-		if processed[currentTable] {
+		if !ts.selectsColumns(tableName, fk.ParentColumns) {
 			continue
 		}
-		processed[currentTable] = true
 
-		ts.Progress.TraversingTable(currentTable, "parents")
+		ts.Progress.TraversingTable(tableName, "children")
 
-		parentFKs := ts.Graph.GetParents(currentTable)
-		for _, fk := range parentFKs {
-			if err := ts.fetchParentRows(ctx, currentTable, fk); err != nil {
+		depths, groups := ts.depthGroups(tableName, indices, func(d rowDepth) int { return d.child }, ts.Options.MaxChildDepth)
+		for _, depth := range depths {
+			err := ts.keyBatches(tableName, groups[depth], fk.ParentColumns, func(keys [][]interface{}) error {
+				return ts.childTasks(fk, keys, rowDepth{child: depth + 1}, emit)
+			})
+			if err != nil {
 				return err
 			}
-
-			queue = append(queue, fk.ParentTable)
 		}
 	}
 
 	return nil
 }
 
-func (ts *TraversalState) fetchParentRows(ctx context.Context, childTable string, fk db.ForeignKey) error {
-	childRows := ts.TableData[childTable]
-	if len(childRows) == 0 {
-		return nil
-	}
-
-	parentValues := make([]interface{}, 0)
-	for _, row := range childRows {
-		value := row[fk.ChildColumn]
-		if value != nil {
-			parentValues = append(parentValues, value)
-		}
-	}
-
-	if len(parentValues) == 0 {
-		return nil
-	}
-
-	parentValues = removeDuplicates(parentValues)
-
-	for i := 0; i < len(parentValues); i += BatchSize {
-		end := i + BatchSize
-		if end > len(parentValues) {
-			end = len(parentValues)
+// keyBatches reads the rows of tableName at the given indices BatchSize rows
+// at a time and calls fn with the distinct value tuples of columns in each
+// batch (see keyTuples). Tuples shared by several batches are passed again;
+// the fetched rows are deduplicated when they are added.
+func (ts *TraversalState) keyBatches(tableName string, indices []int, columns []string, fn func(keys [][]interface{}) error) error {
+	for i := 0; i < len(indices); i += BatchSize {
+		rows, err := ts.Rows.Rows(tableName, indices[i:min(i+BatchSize, len(indices))])
+		if err != nil {
+			return err
 		}
 
-		batch := parentValues[i:end]
-		if err := ts.fetchRowsByPK(ctx, fk.ParentTable, fk.ParentColumn, batch); err != nil {
-			return err
+		if keys := keyTuples(rows, columns); len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
-func (ts *TraversalState) traverseChildren(ctx context.Context, startTable string) error {
-	queue := []string{startTable}
-	processed := make(map[string]bool)
+// selectsColumns reports whether the rows fetched from tableName include the
+// given columns, warning if they do not. Children reference the columns named
+// by the constraint, which need not be the parent's primary key (e.g. a
+// UNIQUE users.email).
+func (ts *TraversalState) selectsColumns(tableName string, columns []string) bool {
+	selected := make(map[string]bool)
+	for _, col := range ts.Graph.GetColumns(tableName) {
+		selected[col.Name] = true
+	}
 
-	selectedChildrenMap := make(map[string]bool)
-	if len(ts.Options.SelectedChildren) > 0 {
-		for _, child := range ts.Options.SelectedChildren {
-			selectedChildrenMap[child] = true
+	for _, col := range columns {
+		if !selected[col] {
+			ts.Progress.Warning("Skipping children of %s: column %s was not selected from %s",
+				tableName, col, tableName)
+			return false
 		}
 	}
+	return true
+}
+
+// advanceCursor moves the cursor of fk in the given direction to end and
+// returns its previous position.
+func (ts *TraversalState) advanceCursor(direction string, fk db.ForeignKey, end int) int {
+	key := fmt.Sprintf("%s|%s|%s|%s", direction, fk.Name, fk.ChildTable, fk.ParentTable)
+	start := ts.cursors[key]
+	ts.cursors[key] = end
+	return start
+}
 
-	for len(queue) > 0 {
-		currentTable := queue[0]
-		queue = queue[1:]
+// rowRange returns the row indices from start up to, but not including, end.
+func rowRange(start, end int) []int {
+	indices := make([]int, 0, end-start)
+	for i := start; i < end; i++ {
+		indices = append(indices, i)
+	}
+	return indices
+}
 
-		if processed[currentTable] {
+// depthGroups groups the rows of tableName at the given indices by the depth
+// selected by depthOf, dropping rows with a negative depth and rows that may
+// not be followed further under maxDepth. Depths are returned in increasing
+// order, so rows are reached along their shortest path first.
+func (ts *TraversalState) depthGroups(tableName string, indices []int, depthOf func(rowDepth) int, maxDepth int) ([]int, map[int][]int) {
+	groups := make(map[int][]int)
+	for _, index := range indices {
+		depth := depthOf(ts.depths[tableName][index])
+		if depth < 0 || !withinDepth(depth, maxDepth) {
 			continue
 		}
-		processed[currentTable] = true
+		groups[depth] = append(groups[depth], index)
+	}
 
-		ts.Progress.TraversingTable(currentTable, "children")
+	depths := make([]int, 0, len(groups))
+	for depth := range groups {
+		depths = append(depths, depth)
+	}
+	sort.Ints(depths)
 
-		childFKs := ts.Graph.GetChildren(currentTable)
-		for _, fk := range childFKs {
-			if len(selectedChildrenMap) > 0 && !selectedChildrenMap[fk.ChildTable] {
-				continue
+	return depths, groups
+}
+
+// parentTasks passes to emit the batched fetches of the parent rows referenced
+// through fk by the given key tuples of child rows. When fk references the
+// parent's row key, parents that were already extracted are not fetched again.
+func (ts *TraversalState) parentTasks(fk db.ForeignKey, keys [][]interface{}, depth rowDepth, emit func(fetchTask) error) error {
+	if slices.Equal(fk.ParentColumns, ts.Graph.GetRowKeyColumns(fk.ParentTable)) {
+		missing := make([][]interface{}, 0, len(keys))
+		for _, key := range keys {
+			row := make(map[string]interface{}, len(key))
+			for i, col := range fk.ParentColumns {
+				row[col] = key[i]
 			}
 
-			if err := ts.fetchChildRows(ctx, currentTable, fk); err != nil {
+			identity, err := rowIdentity(row, fk.ParentColumns, fk.ParentTable)
+			if err != nil {
 				return err
 			}
-
-			queue = append(queue, fk.ChildTable)
+			_, visited, err := ts.Rows.Lookup(fk.ParentTable, identity)
+			if err != nil {
+				return err
+			}
+			if !visited {
+				missing = append(missing, key)
+			}
 		}
+		keys = missing
 	}
 
-	return nil
+	return ts.keyTasks(fk.ParentTable, fk.ParentColumns, keys, depth, emit)
 }
 
-func (ts *TraversalState) fetchChildRows(ctx context.Context, parentTable string, fk db.ForeignKey) error {
-	parentRows := ts.TableData[parentTable]
-	if len(parentRows) == 0 {
-		return nil
-	}
-
-	pkColumn := ts.Graph.GetPrimaryKey(parentTable)
-	parentPKs := make([]interface{}, 0)
-	for _, row := range parentRows {
-		value := row[pkColumn]
-		if value != nil {
-			parentPKs = append(parentPKs, value)
+// keyTasks passes to emit the fetches of the rows of tableName whose
+// keyColumns match one of the given key tuples, in batches of BatchSize keys.
+func (ts *TraversalState) keyTasks(tableName string, keyColumns []string, keys [][]interface{}, depth rowDepth, emit func(fetchTask) error) error {
+	for i := 0; i < len(keys); i += BatchSize {
+		task, err := ts.keyTask(tableName, keyColumns, keys[i:min(i+BatchSize, len(keys))], depth)
+		if err != nil {
+			return err
+		}
+		if err := emit(task); err != nil {
+			return err
 		}
 	}
 
-	if len(parentPKs) == 0 {
+	return nil
+}
+
+// childTasks passes to emit the batched fetches of the child rows referencing
+// the given parent key tuples through fk.
+func (ts *TraversalState) childTasks(fk db.ForeignKey, parentKeys [][]interface{}, depth rowDepth, emit func(fetchTask) error) error {
+	remaining := ts.remainingRows(fk.ChildTable)
+	if remaining == 0 {
+		// Later rounds keep reaching the table; report it once per run
+		if !ts.limited[fk.ChildTable] {
+			ts.limited[fk.ChildTable] = true
+			ts.Progress.Warning("Row limit for %s reached; skipping further child rows", fk.ChildTable)
+		}
 		return nil
 	}
 
-	parentPKs = removeDuplicates(parentPKs)
-
-	for i := 0; i < len(parentPKs); i += BatchSize {
-		end := i + BatchSize
-		if end > len(parentPKs) {
-			end = len(parentPKs)
+	for i := 0; i < len(parentKeys); i += BatchSize {
+		task, err := ts.fkTask(fk.ChildTable, fk.ChildColumns, parentKeys[i:min(i+BatchSize, len(parentKeys))], remaining, depth)
+		if err != nil {
+			return err
 		}
-
-		batch := parentPKs[i:end]
-		if err := ts.fetchRowsByFK(ctx, fk.ChildTable, fk.ChildColumn, batch); err != nil {
+		if err := emit(task); err != nil {
 			return err
 		}
 	}
@@ -465,134 +555,143 @@ func (ts *TraversalState) fetchChildRows(ctx context.Context, parentTable string
 	return nil
 }
 
-func (ts *TraversalState) fetchRowsByPK(ctx context.Context, tableName, pkColumn string, values []interface{}) error {
-	if len(values) == 0 {
-		return nil
+// remainingRows returns how many more rows child traversal may fetch from
+// tableName under its --table-limit, or -1 if the table has no limit.
+func (ts *TraversalState) remainingRows(tableName string) int {
+	limit, ok := ts.Options.TableLimits[tableName]
+	if !ok {
+		return -1
 	}
 
-	// Get column information to detect JSONB/JSON columns
-	columnQuery := `
-		SELECT column_name, data_type
-		FROM information_schema.columns
-		WHERE table_schema = 'public' 
-		  AND table_name = $1
-		ORDER BY ordinal_position
-	`
+	remaining := limit - ts.Rows.Len(tableName)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
 
-	colRows, err := ts.Connection.Pool.Query(ctx, columnQuery, tableName)
+// keyTask builds the fetch of the rows of tableName whose keyColumns match one
+// of the given key tuples. The key columns are the columns referenced by a
+// foreign key, which may be the primary key or any unique key of the table.
+func (ts *TraversalState) keyTask(tableName string, keyColumns []string, keys [][]interface{}, depth rowDepth) (fetchTask, error) {
+	selectCols, err := ts.selectColumns(tableName)
 	if err != nil {
-		return fmt.Errorf("failed to get column info for %s: %w", tableName, err)
+		return fetchTask{}, err
 	}
 
-	jsonbCols := make(map[string]bool)
-	var selectCols []string
-
-	for colRows.Next() {
-		var colName, dataType string
-		if err := colRows.Scan(&colName, &dataType); err != nil {
-			colRows.Close()
-			return fmt.Errorf("failed to scan column info: %w", err)
-		}
-
-		// For JSONB/JSON columns, cast to text to preserve exact representation
-		if dataType == "jsonb" || dataType == "json" {
-			jsonbCols[colName] = true
-			// Use to_jsonb() to preserve the distinction between JSONB null and SQL NULL
-			// to_jsonb(NULL) returns SQL NULL, but to_jsonb('null'::jsonb)::text returns "null"
-			selectCols = append(selectCols, fmt.Sprintf("to_jsonb(%s)::text AS %s", colName, colName))
-		} else {
-			selectCols = append(selectCols, colName)
-		}
-	}
-	colRows.Close()
-
-	placeholders := make([]string, len(values))
-	for i := range values {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
-	}
+	whereClause, args := tupleInClause(keyColumns, keys)
 
 	// Use explicit column list with JSONB columns cast to text
-	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (%s) ORDER BY %s",
-		strings.Join(selectCols, ", "), tableName, pkColumn, strings.Join(placeholders, ", "), pkColumn)
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s",
+		strings.Join(selectCols, ", "), db.QuoteTable(tableName), whereClause, strings.Join(keyColumns, ", "))
+
+	return fetchTask{table: tableName, query: query, args: args, depth: depth}, nil
+}
 
-	rows, err := ts.Connection.Pool.Query(ctx, query, values...)
+// fkTask builds the fetch of the rows of tableName whose fkColumns match one of
+// the given key tuples, applying the table's child limits (see childQuery).
+func (ts *TraversalState) fkTask(tableName string, fkColumns []string, keys [][]interface{}, remaining int, depth rowDepth) (fetchTask, error) {
+	selectCols, err := ts.selectColumns(tableName)
 	if err != nil {
-		return fmt.Errorf("failed to fetch rows from %s: %w", tableName, err)
+		return fetchTask{}, err
 	}
-	defer rows.Close()
 
-	return ts.processRowsWithJSONBInfo(ctx, rows, tableName, jsonbCols)
-}
+	whereClause, args := tupleInClause(fkColumns, keys)
 
-func (ts *TraversalState) fetchRowsByFK(ctx context.Context, tableName, fkColumn string, values []interface{}) error {
-	if len(values) == 0 {
-		return nil
-	}
+	// Use explicit column list with JSONB columns cast to text
+	query := childQuery(ts.Graph, ts.Options, tableName, selectCols, fkColumns, whereClause, remaining)
 
-	// Get column information to detect JSONB/JSON columns
-	columnQuery := `
-		SELECT column_name, data_type
-		FROM information_schema.columns
-		WHERE table_schema = 'public' 
-		  AND table_name = $1
-		ORDER BY ordinal_position
-	`
+	return fetchTask{table: tableName, query: query, args: args, depth: depth, limited: remaining >= 0}, nil
+}
 
-	colRows, err := ts.Connection.Pool.Query(ctx, columnQuery, tableName)
-	if err != nil {
-		return fmt.Errorf("failed to get column info for %s: %w", tableName, err)
+// selectColumns builds the SELECT list for a table from the graph's column
+// metadata, casting JSONB/JSON columns to text.
+func (ts *TraversalState) selectColumns(tableName string) ([]string, error) {
+	columns := ts.Graph.GetColumns(tableName)
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no column information for table %s", tableName)
 	}
 
-	jsonbCols := make(map[string]bool)
-	var selectCols []string
-
-	for colRows.Next() {
-		var colName, dataType string
-		if err := colRows.Scan(&colName, &dataType); err != nil {
-			colRows.Close()
-			return fmt.Errorf("failed to scan column info: %w", err)
-		}
+	selectCols := make([]string, 0, len(columns))
 
+	for _, col := range columns {
 		// For JSONB/JSON columns, cast to text to preserve exact representation
-		if dataType == "jsonb" || dataType == "json" {
-			jsonbCols[colName] = true
+		if col.IsJSON() {
 			// Use to_jsonb() to preserve the distinction between JSONB null and SQL NULL
 			// to_jsonb(NULL) returns SQL NULL, but to_jsonb('null'::jsonb)::text returns "null"
-			selectCols = append(selectCols, fmt.Sprintf("to_jsonb(%s)::text AS %s", colName, colName))
+			selectCols = append(selectCols, fmt.Sprintf("to_jsonb(%s)::text AS %s", col.Name, col.Name))
 		} else {
-			selectCols = append(selectCols, colName)
+			selectCols = append(selectCols, col.Name)
 		}
 	}
-	colRows.Close()
 
-	placeholders := make([]string, len(values))
-	for i := range values {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	return selectCols, nil
+}
+
+// rowIdentity returns the deduplication key of a row from its key columns:
+// the text form of the key value, or of all values for composite keys. Tables
+// without a key (empty keyColumns) are identified by the whole row, using
+// every column in name order.
+func rowIdentity(rowMap map[string]interface{}, keyColumns []string, tableName string) (string, error) {
+	if len(keyColumns) == 0 {
+		columns := make([]string, 0, len(rowMap))
+		for col := range rowMap {
+			columns = append(columns, col)
+		}
+		sort.Strings(columns)
+
+		var key strings.Builder
+		for _, col := range columns {
+			fmt.Fprintf(&key, "%s=%v;", col, rowMap[col])
+		}
+		return key.String(), nil
 	}
 
-	pkColumn := ts.Graph.GetPrimaryKey(tableName)
-	// Use explicit column list with JSONB columns cast to text
-	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (%s) ORDER BY %s",
-		strings.Join(selectCols, ", "), tableName, fkColumn, strings.Join(placeholders, ", "), pkColumn)
+	keyValues := make([]interface{}, 0, len(keyColumns))
+	for _, keyCol := range keyColumns {
+		value, exists := rowMap[keyCol]
+		if !exists {
+			return "", fmt.Errorf("key value(s) missing in table %s", tableName)
+		}
+		keyValues = append(keyValues, value)
+	}
 
-	rows, err := ts.Connection.Pool.Query(ctx, query, values...)
-	if err != nil {
-		return fmt.Errorf("failed to fetch rows from %s: %w", tableName, err)
+	// Composite keys format all values; single keys just the value
+	if len(keyValues) == 1 {
+		if keyValues[0] == nil {
+			return "", fmt.Errorf("key value is NULL in table %s", tableName)
+		}
+		return fmt.Sprintf("%v", keyValues[0]), nil
 	}
-	defer rows.Close()
 
-	return ts.processRowsWithJSONBInfo(ctx, rows, tableName, jsonbCols)
+	return fmt.Sprintf("%v", keyValues), nil
 }
 
-func removeDuplicates(values []interface{}) []interface{} {
-	seen := make(map[interface{}]bool)
-	result := make([]interface{}, 0)
+// keyTuples collects the distinct value tuples of the given columns from rows,
+// sorted for deterministic batching. Tuples with a NULL component are skipped,
+// matching the MATCH SIMPLE semantics of PostgreSQL foreign keys.
+func keyTuples(rows []map[string]interface{}, columns []string) [][]interface{} {
+	seen := make(map[string]bool)
+	result := make([][]interface{}, 0)
+
+	for _, row := range rows {
+		tuple := make([]interface{}, len(columns))
+		complete := true
+		for i, col := range columns {
+			tuple[i] = row[col]
+			if tuple[i] == nil {
+				complete = false
+				break
+			}
+		}
+		if !complete {
+			continue
+		}
 
-	for _, value := range values {
-		key := fmt.Sprintf("%v", value)
+		key := fmt.Sprintf("%v", tuple)
 		if !seen[key] {
 			seen[key] = true
-			result = append(result, value)
+			result = append(result, tuple)
 		}
 	}
 
@@ -603,11 +702,49 @@ func removeDuplicates(values []interface{}) []interface{} {
 	return result
 }
 
+// tupleInClause renders a row-value IN condition matching any of the given key
+// tuples, e.g. "id IN ($1, $2)" for a single column or
+// "(tenant_id, id) IN (($1, $2), ($3, $4))" for composite keys.
+// It returns the condition together with its flattened arguments.
+func tupleInClause(columns []string, tuples [][]interface{}) (string, []interface{}) {
+	args := make([]interface{}, 0, len(tuples)*len(columns))
+	placeholders := make([]string, len(tuples))
+
+	for i, tuple := range tuples {
+		params := make([]string, len(tuple))
+		for j, value := range tuple {
+			args = append(args, value)
+			params[j] = fmt.Sprintf("$%d", len(args))
+		}
+
+		if len(columns) == 1 {
+			placeholders[i] = params[0]
+		} else {
+			placeholders[i] = fmt.Sprintf("(%s)", strings.Join(params, ", "))
+		}
+	}
+
+	target := columns[0]
+	if len(columns) > 1 {
+		target = fmt.Sprintf("(%s)", strings.Join(columns, ", "))
+	}
+
+	return fmt.Sprintf("%s IN (%s)", target, strings.Join(placeholders, ", ")), args
+}
+
 // GetAllTables returns a list of all tables that have extracted data.
 func (ts *TraversalState) GetAllTables() []string {
-	tables := make([]string, 0, len(ts.TableData))
-	for table := range ts.TableData {
-		tables = append(tables, table)
+	return ts.Rows.Tables()
+}
+
+// HasRow reports whether a row of tableName with the given row key values,
+// by row key column, was extracted.
+func (ts *TraversalState) HasRow(tableName string, key map[string]interface{}) (bool, error) {
+	identity, err := rowIdentity(key, ts.Graph.GetRowKeyColumns(tableName), tableName)
+	if err != nil {
+		return false, err
 	}
-	return tables
+
+	_, found, err := ts.Rows.Lookup(tableName, identity)
+	return found, err
 }
@@ -0,0 +1,106 @@
+package extractor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+	"github.com/riyasyash/pg_rocket/internal/graph"
+)
+
+func TestAddRowsUpgradeResetsDepth(t *testing.T) {
+	g := graph.NewGraph(&db.Metadata{
+		PrimaryKey: map[string][]string{"public.users": {"id"}},
+		Columns:    map[string][]db.Column{"public.users": {{Name: "id", NotNull: true}}},
+	})
+	ts, err := NewTraversalState(g, nil, &TraversalOptions{MaxRows: 100, MaxParentDepth: -1, MaxChildDepth: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	row := func() []map[string]interface{} { return []map[string]interface{}{{"id": int64(1)}} }
+
+	// Reached first three parent hops away from a child row, then as a child
+	if err := ts.addRows(fetchTask{table: "public.users", depth: rowDepth{child: -1, parent: 3}}, row()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.addRows(fetchTask{table: "public.users", depth: rowDepth{child: 2}}, row()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := ts.depths["public.users"][0], (rowDepth{child: 2}); got != want {
+		t.Errorf("depth = %+v, want %+v", got, want)
+	}
+	if got := ts.upgraded["public.users"]; len(got) != 1 || got[0] != 0 {
+		t.Errorf("upgraded = %v, want [0]", got)
+	}
+
+	// A later child path does not upgrade the row again
+	if err := ts.addRows(fetchTask{table: "public.users", depth: rowDepth{child: 4}}, row()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ts.depths["public.users"][0], (rowDepth{child: 2}); got != want {
+		t.Errorf("depth after a longer child path = %+v, want %+v", got, want)
+	}
+}
+
+func TestTraverseTableBatchesRowsAndSkipsVisitedParents(t *testing.T) {
+	fk := db.ForeignKey{
+		Name:          "orders_user_id_fkey",
+		ChildTable:    "public.orders",
+		ChildColumns:  []string{"user_id"},
+		ParentTable:   "public.users",
+		ParentColumns: []string{"id"},
+	}
+	g := graph.NewGraph(&db.Metadata{
+		Parents:    map[string][]db.ForeignKey{"public.orders": {fk}},
+		Children:   map[string][]db.ForeignKey{"public.users": {fk}},
+		PrimaryKey: map[string][]string{"public.orders": {"id"}, "public.users": {"id"}},
+		Columns: map[string][]db.Column{
+			"public.orders": {{Name: "id", NotNull: true}, {Name: "user_id"}},
+			"public.users":  {{Name: "id", NotNull: true}},
+		},
+	})
+	ts, err := NewTraversalState(g, nil, &TraversalOptions{MaxRows: 10000, MaxParentDepth: -1, MaxChildDepth: -1, ParentsOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	orders := make([]map[string]interface{}, 0)
+	for i := 0; i < 2*BatchSize+1; i++ {
+		orders = append(orders, map[string]interface{}{"id": int64(i), "user_id": int64(i % 3)})
+	}
+	if err := ts.addRows(fetchTask{table: "public.orders"}, orders); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.addRows(fetchTask{table: "public.users"}, []map[string]interface{}{{"id": int64(0)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := make([]fetchTask, 0)
+	err = ts.traverseTable("public.orders", ts.Rows.Len("public.orders"), nil, func(task fetchTask) error {
+		tasks = append(tasks, task)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One fetch per batch of orders, of the users not extracted yet
+	if len(tasks) != 3 {
+		t.Fatalf("%d tasks, want 3", len(tasks))
+	}
+	for _, task := range tasks[:2] {
+		if want := []interface{}{int64(1), int64(2)}; !reflect.DeepEqual(task.args, want) {
+			t.Errorf("task args = %v, want %v", task.args, want)
+		}
+	}
+	if want := []interface{}{int64(1)}; !reflect.DeepEqual(tasks[2].args, want) {
+		t.Errorf("last task args = %v, want %v", tasks[2].args, want)
+	}
+	if want := (rowDepth{child: -1, parent: 1}); tasks[0].depth != want {
+		t.Errorf("task depth = %+v, want %+v", tasks[0].depth, want)
+	}
+}
@@ -2,32 +2,242 @@ package extractor
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/riyasyash/pg_rocket/internal/db"
 )
 
+// seedAliasSeparator separates the table from the column in the name of a
+// column projecting a seed table's key, e.g. users__id.
+const seedAliasSeparator = "__"
+
 // QueryInfo contains validated information about a SQL query
-// including the base table it operates on.
+// including the tables it extracts data from.
 type QueryInfo struct {
-	Query     string // The original SQL SELECT query
-	BaseTable string // The table this query extracts data from
+	Query  string       // The original SQL SELECT query
+	Params []QueryParam // Values bound to the query's $n and :name placeholders
+	Seeds  []Seed       // The tables whose rows the query selects
+}
+
+// Seed is a table whose rows a root query selects by projecting their key.
+// The query only selects keys: the full rows are fetched from the table by
+// key, so partial projections such as SELECT id FROM users yield whole rows.
+type Seed struct {
+	Table string // Schema-qualified table name
+
+	// Query columns holding the table's row key, in key order. Empty for a
+	// table without a key, whose rows the query must return whole.
+	Columns []string
+}
+
+// Tables returns the tables the query seeds the extraction with.
+func (q *QueryInfo) Tables() []string {
+	tables := make([]string, len(q.Seeds))
+	for i, seed := range q.Seeds {
+		tables[i] = seed.Table
+	}
+	return tables
+}
+
+// bind numbers the placeholders of sql, a query embedding the root query, and
+// returns it with the values they bind (see bindParams).
+func (q *QueryInfo) bind(sql string) (string, []interface{}) {
+	return bindParams(sql, q.Params)
+}
+
+// keyQuery returns the query selecting the seed key columns from the rows of
+// the query, keeping only the rows chosen by sample if it is set. Sampled keys
+// are deduplicated first, so that a sample of N rows has N distinct keys.
+func (q *QueryInfo) keyQuery(sample *Sample) string {
+	keyCols := make([]string, 0)
+	for _, seed := range q.Seeds {
+		for _, col := range seed.Columns {
+			keyCols = append(keyCols, db.QuoteIdentifier(col))
+		}
+	}
+	columns := strings.Join(keyCols, ", ")
+
+	if sample == nil {
+		return fmt.Sprintf("SELECT %s FROM %s", columns, db.Subquery(q.Query, "root"))
+	}
+
+	distinct := fmt.Sprintf("SELECT DISTINCT %s FROM %s", columns, db.Subquery(q.Query, "root"))
+	return fmt.Sprintf("SELECT %s FROM %s%s", columns, db.Subquery(distinct, "root"),
+		sample.clause(fmt.Sprintf("ROW(%s)::text", columns)))
+}
+
+// rowsQuery returns the query selecting columns from the rows of a query on a
+// keyless table, keeping only the rows chosen by sample if it is set. Sampled
+// rows are identified by their whole value; the alias is unlikely to clash
+// with a column name.
+func (q *QueryInfo) rowsQuery(columns []string, sample *Sample) string {
+	return fmt.Sprintf("SELECT %s FROM %s%s", strings.Join(columns, ", "),
+		db.Subquery(q.Query, "pg_rocket_root"), sample.clause("pg_rocket_root::text"))
 }
 
-// ValidateQuery analyzes a SQL query to determine the base table and validates
-// that the query is suitable for data extraction (read-only, single table,
-// includes primary key columns).
-func ValidateQuery(ctx context.Context, conn *db.Connection, query string, metadata *db.Metadata) (*QueryInfo, error) {
-	baseTable, err := conn.DetectBaseTable(ctx, query)
+// ValidateQuery analyzes a SQL query to determine the tables it extracts data
+// from and validates that the query is suitable for data extraction.
+//
+// A query scanning a single table selects rows of that table, and must include
+// its primary key columns. Other queries may join freely but must project the
+// key of their seed tables: either columns named table__column, which declare
+// the seeds, or the plain key columns of the one table of seedTables the query
+// scans. Queries on a table without a key must select all of its columns.
+// The query's placeholders are bound to params: $n to the n-th, :name to the
+// one of that name.
+func ValidateQuery(ctx context.Context, conn *db.Connection, query string, params []QueryParam, metadata *db.Metadata, seedTables []string) (*QueryInfo, error) {
+	if n := maxPlaceholder(query); n > len(params) {
+		return nil, fmt.Errorf("query uses $%d but only %d --param values are given", n, len(params))
+	}
+
+	bound, args := bindParams(query, params)
+	tables, err := conn.QueryTables(ctx, bound, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := conn.ValidateQuery(ctx, query, baseTable, metadata); err != nil {
+	scanned := make(map[string]bool)
+	for _, table := range tables {
+		scanned[table] = true
+	}
+
+	columns, err := conn.QueryColumns(ctx, bound, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate query: %w", err)
+	}
+
+	if seeds, err := aliasedSeeds(columns, scanned, metadata); err != nil || len(seeds) > 0 {
+		return &QueryInfo{Query: query, Params: params, Seeds: seeds}, err
+	}
+
+	declared := make([]string, 0)
+	for _, table := range seedTables {
+		if scanned[table] {
+			declared = append(declared, table)
+		}
+	}
+
+	switch {
+	case len(declared) > 1:
+		return nil, fmt.Errorf("query scans several seed tables %v. Alias their key columns as table%scolumn", declared, seedAliasSeparator)
+	case len(declared) == 0 && len(tables) > 1:
+		return nil, fmt.Errorf("query references multiple tables: %v. Declare the seed table with --seed-table, or alias its key columns as table%scolumn", tables, seedAliasSeparator)
+	}
+
+	table := tables[0]
+	if len(declared) == 1 {
+		table = declared[0]
+	}
+
+	if len(tables) == 1 && len(metadata.RowKey(table)) == 0 {
+		if err := checkWholeRows(table, metadata, columns); err != nil {
+			return nil, err
+		}
+		return &QueryInfo{Query: query, Params: params, Seeds: []Seed{{Table: table}}}, nil
+	}
+
+	seed, err := newSeed(table, metadata, func(keyCol string) string { return keyCol }, columns)
+	if err != nil {
 		return nil, err
 	}
+	return &QueryInfo{Query: query, Params: params, Seeds: []Seed{seed}}, nil
+}
+
+// checkWholeRows checks that columns include every column of table, which has
+// no key to fetch its rows by.
+func checkWholeRows(table string, metadata *db.Metadata, columns []string) error {
+	if _, exists := metadata.Columns[table]; !exists {
+		return fmt.Errorf("table '%s' not found in schemas %v", table, metadata.Schemas)
+	}
+
+	projected := make(map[string]bool)
+	for _, col := range columns {
+		projected[col] = true
+	}
+
+	missing := make([]string, 0)
+	for _, col := range metadata.Columns[table] {
+		if !projected[col.Name] {
+			missing = append(missing, col.Name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("query must select every column of %s, which has no primary key or NOT NULL unique key. Missing: %v", table, missing)
+	}
+
+	return nil
+}
+
+// aliasedSeeds returns the seeds declared by columns named table__column,
+// where table is one of the scanned tables, in table order. Other columns are
+// ignored.
+func aliasedSeeds(columns []string, scanned map[string]bool, metadata *db.Metadata) ([]Seed, error) {
+	aliased := make(map[string]bool)
+	order := make([]string, 0)
+	prefixes := make(map[string]string) // Seed table -> prefix used in its aliases
+
+	for _, col := range columns {
+		prefix, _, ok := strings.Cut(col, seedAliasSeparator)
+		if !ok {
+			continue
+		}
+		table, err := metadata.ResolveTable(prefix)
+		if err != nil || !scanned[table] {
+			continue
+		}
+		if !aliased[table] {
+			aliased[table] = true
+			order = append(order, table)
+			prefixes[table] = prefix
+		}
+	}
+
+	seeds := make([]Seed, 0, len(order))
+	for _, table := range order {
+		prefix := prefixes[table]
+		seed, err := newSeed(table, metadata, func(keyCol string) string {
+			return prefix + seedAliasSeparator + keyCol
+		}, columns)
+		if err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, seed)
+	}
+
+	return seeds, nil
+}
+
+// newSeed checks that columns include the row key of table, named by column,
+// and returns the seed selecting rows of table by those columns.
+func newSeed(table string, metadata *db.Metadata, column func(keyCol string) string, columns []string) (Seed, error) {
+	if _, exists := metadata.Columns[table]; !exists {
+		return Seed{}, fmt.Errorf("table '%s' not found in schemas %v", table, metadata.Schemas)
+	}
+
+	keyColumns := metadata.RowKey(table)
+	if len(keyColumns) == 0 {
+		return Seed{}, fmt.Errorf("seed table %s has no primary key or NOT NULL unique key to select its rows by", table)
+	}
+
+	projected := make(map[string]bool)
+	for _, col := range columns {
+		projected[col] = true
+	}
+
+	seed := Seed{Table: table, Columns: make([]string, len(keyColumns))}
+	missing := make([]string, 0)
+	for i, keyCol := range keyColumns {
+		seed.Columns[i] = column(keyCol)
+		if !projected[seed.Columns[i]] {
+			missing = append(missing, seed.Columns[i])
+		}
+	}
+
+	if len(missing) > 0 {
+		return Seed{}, fmt.Errorf("query must include all key columns of %s. Missing: %v", table, missing)
+	}
 
-	return &QueryInfo{
-		Query:     query,
-		BaseTable: baseTable,
-	}, nil
+	return seed, nil
 }
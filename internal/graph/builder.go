@@ -1,103 +1,102 @@
 package graph
 
 import (
-	"fmt"
 	"sort"
-	"strings"
 
 	"github.com/riyasyash/pg_rocket/internal/db"
 )
 
-// BuildGraph constructs a foreign key graph from database metadata and validates
-// that no multi-table cycles exist. Returns an error if cycles are detected.
+// BuildGraph constructs a foreign key graph from database metadata.
+// Multi-table cycles are allowed; they are resolved at insert time
+// (see PlanInserts).
 func BuildGraph(metadata *db.Metadata) (*Graph, error) {
-	graph := NewGraph(metadata)
+	return NewGraph(metadata), nil
+}
 
-	if err := graph.DetectMultiTableCycles(); err != nil {
-		return nil, err
+// Cycles returns the groups of tables that form multi-table foreign key cycles,
+// i.e. the strongly connected components with more than one table.
+func (g *Graph) Cycles() [][]string {
+	cycles := make([][]string, 0)
+	for _, component := range g.StronglyConnectedComponents(g.Tables()) {
+		if len(component) > 1 {
+			cycles = append(cycles, component)
+		}
 	}
-
-	return graph, nil
+	return cycles
 }
 
-// DetectMultiTableCycles performs depth-first search to detect cycles in the FK graph.
-// Self-referential foreign keys are excluded. Returns an error if a cycle is found,
-// including the path of tables involved in the cycle.
-func (g *Graph) DetectMultiTableCycles() error {
-	allTables := make(map[string]bool)
-
-	for table := range g.Parents {
-		allTables[table] = true
-	}
-	for table := range g.Children {
-		allTables[table] = true
+// StronglyConnectedComponents partitions the given tables into strongly connected
+// components of the FK graph restricted to those tables, using Tarjan's algorithm.
+// Self-referential foreign keys are ignored. Each component is sorted by name and
+// components are ordered by their first table, so the result is deterministic.
+func (g *Graph) StronglyConnectedComponents(tables []string) [][]string {
+	tableSet := make(map[string]bool)
+	for _, table := range tables {
+		tableSet[table] = true
 	}
 
-	color := make(map[string]int)
-	parent := make(map[string]string)
-
-	const (
-		WHITE = 0
-		GRAY  = 1
-		BLACK = 2
-	)
-
-	for table := range allTables {
-		color[table] = WHITE
+	sorted := make([]string, 0, len(tableSet))
+	for table := range tableSet {
+		sorted = append(sorted, table)
 	}
-
-	var dfs func(string) error
-	dfs = func(table string) error {
-		color[table] = GRAY
-
-		for _, fk := range g.Children[table] {
-			childTable := fk.ChildTable
-
-			if childTable == table {
+	sort.Strings(sorted)
+
+	index := make(map[string]int)
+	lowLink := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+	components := make([][]string, 0)
+	counter := 0
+
+	var visit func(string)
+	visit = func(table string) {
+		index[table] = counter
+		lowLink[table] = counter
+		counter++
+		stack = append(stack, table)
+		onStack[table] = true
+
+		for _, fk := range g.Parents[table] {
+			parent := fk.ParentTable
+			if parent == table || !tableSet[parent] {
 				continue
 			}
 
-			if color[childTable] == GRAY {
-				cycle := []string{childTable}
-				current := table
-				for current != childTable && current != "" {
-					cycle = append(cycle, current)
-					current = parent[current]
+			if _, visited := index[parent]; !visited {
+				visit(parent)
+				if lowLink[parent] < lowLink[table] {
+					lowLink[table] = lowLink[parent]
 				}
-				cycle = append(cycle, childTable)
-
-				for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
-					cycle[i], cycle[j] = cycle[j], cycle[i]
-				}
-
-				return fmt.Errorf("cyclic foreign keys detected: %s. Use --parents or --children to avoid cycles", strings.Join(cycle, " -> "))
+			} else if onStack[parent] && index[parent] < lowLink[table] {
+				lowLink[table] = index[parent]
 			}
+		}
 
-			if color[childTable] == WHITE {
-				parent[childTable] = table
-				if err := dfs(childTable); err != nil {
-					return err
+		if lowLink[table] == index[table] {
+			component := make([]string, 0)
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == table {
+					break
 				}
 			}
+			sort.Strings(component)
+			components = append(components, component)
 		}
-
-		color[table] = BLACK
-		return nil
 	}
 
-	tables := make([]string, 0, len(allTables))
-	for table := range allTables {
-		tables = append(tables, table)
-	}
-	sort.Strings(tables)
-
-	for _, table := range tables {
-		if color[table] == WHITE {
-			if err := dfs(table); err != nil {
-				return err
-			}
+	for _, table := range sorted {
+		if _, visited := index[table]; !visited {
+			visit(table)
 		}
 	}
 
-	return nil
+	sort.Slice(components, func(i, j int) bool {
+		return components[i][0] < components[j][0]
+	})
+
+	return components
 }
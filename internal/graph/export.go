@@ -0,0 +1,355 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+)
+
+// Output formats supported by Render.
+const (
+	FormatText    = "text"
+	FormatDOT     = "dot"
+	FormatMermaid = "mermaid"
+	FormatJSON    = "json"
+)
+
+// Formats lists the output formats supported by Render.
+var Formats = []string{FormatText, FormatDOT, FormatMermaid, FormatJSON}
+
+// Edge is a foreign key as presented to renderers, with derived properties.
+type Edge struct {
+	db.ForeignKey
+	Nullable      bool // All child columns accept NULL, so the reference is optional
+	SelfReference bool // Child and parent are the same table
+}
+
+// RelatedTables returns the tables that take part in at least one foreign key,
+// in alphabetical order.
+func (g *Graph) RelatedTables() []string {
+	tableSet := make(map[string]bool)
+	for table, fks := range g.Parents {
+		if len(fks) > 0 {
+			tableSet[table] = true
+		}
+	}
+	for table, fks := range g.Children {
+		if len(fks) > 0 {
+			tableSet[table] = true
+		}
+	}
+
+	tables := make([]string, 0, len(tableSet))
+	for table := range tableSet {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Edges returns the foreign keys whose child and parent are both among tables,
+// ordered by child table, parent table and constraint name.
+func (g *Graph) Edges(tables []string) []Edge {
+	tableSet := make(map[string]bool)
+	for _, table := range tables {
+		tableSet[table] = true
+	}
+
+	edges := make([]Edge, 0)
+	for _, table := range tables {
+		for _, fk := range g.Parents[table] {
+			if !tableSet[fk.ParentTable] {
+				continue
+			}
+			edges = append(edges, Edge{
+				ForeignKey:    fk,
+				Nullable:      g.IsNullable(fk.ChildTable, fk.ChildColumns),
+				SelfReference: fk.ChildTable == fk.ParentTable,
+			})
+		}
+	}
+
+	sort.SliceStable(edges, func(i, j int) bool {
+		if edges[i].ChildTable != edges[j].ChildTable {
+			return edges[i].ChildTable < edges[j].ChildTable
+		}
+		if edges[i].ParentTable != edges[j].ParentTable {
+			return edges[i].ParentTable < edges[j].ParentTable
+		}
+		return edges[i].Name < edges[j].Name
+	})
+
+	return edges
+}
+
+// Render writes the FK graph restricted to the given tables in the requested format.
+func (g *Graph) Render(w io.Writer, format string, tables []string) error {
+	switch format {
+	case FormatText, "":
+		return g.writeText(w, tables)
+	case FormatDOT:
+		return g.writeDOT(w, tables)
+	case FormatMermaid:
+		return g.writeMermaid(w, tables)
+	case FormatJSON:
+		return g.writeJSON(w, tables)
+	default:
+		return fmt.Errorf("unknown format '%s' (expected text, dot, mermaid or json)", format)
+	}
+}
+
+// ColumnPairs renders the column mapping of a foreign key, e.g. "user_id → id"
+// or "(tenant_id, user_id) → (tenant_id, id)" for composite keys.
+func ColumnPairs(fk db.ForeignKey) string {
+	return fmt.Sprintf("%s → %s", formatColumns(fk.ChildColumns), formatColumns(fk.ParentColumns))
+}
+
+// formatColumns renders a column list as "col" or, for composite keys, "(a, b)".
+func formatColumns(columns []string) string {
+	if len(columns) == 1 {
+		return columns[0]
+	}
+	return "(" + strings.Join(columns, ", ") + ")"
+}
+
+// edgeFlags lists the notable properties of an edge, e.g. "nullable, virtual".
+func edgeFlags(edge Edge) string {
+	flags := make([]string, 0)
+	if edge.Nullable {
+		flags = append(flags, "nullable")
+	}
+	if edge.SelfReference {
+		flags = append(flags, "self")
+	}
+	if edge.Virtual {
+		flags = append(flags, "virtual")
+	}
+	if edge.Deferrable {
+		flags = append(flags, "deferrable")
+	}
+	return strings.Join(flags, ", ")
+}
+
+func (g *Graph) writeText(w io.Writer, tables []string) error {
+	edges := g.Edges(tables)
+
+	parents := make(map[string][]Edge)
+	children := make(map[string][]Edge)
+	for _, edge := range edges {
+		parents[edge.ChildTable] = append(parents[edge.ChildTable], edge)
+		children[edge.ParentTable] = append(children[edge.ParentTable], edge)
+	}
+
+	fmt.Fprintln(w, "Database Foreign Key Graph:")
+	fmt.Fprintln(w)
+
+	for _, table := range tables {
+		fmt.Fprintf(w, "%s\n", table)
+
+		for _, edge := range parents[table] {
+			fmt.Fprintf(w, "  ↑ %s (via %s)%s\n", edge.ParentTable, strings.Join(edge.ChildColumns, ", "), virtualMarker(edge))
+		}
+
+		// Children are listed by child table, then constraint name
+		tableChildren := children[table]
+		sort.SliceStable(tableChildren, func(i, j int) bool {
+			return tableChildren[i].ChildTable < tableChildren[j].ChildTable
+		})
+		for _, edge := range tableChildren {
+			fmt.Fprintf(w, "  ↓ %s (via %s.%s)%s\n", edge.ChildTable, edge.ChildTable, formatColumns(edge.ChildColumns), virtualMarker(edge))
+		}
+
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
+
+// virtualMarker labels foreign keys that were declared in the config file.
+func virtualMarker(edge Edge) string {
+	if edge.Virtual {
+		return " [virtual]"
+	}
+	return ""
+}
+
+// writeDOT renders the graph in Graphviz DOT format. Edges point from child to
+// parent; nullable references are dashed and virtual ones dotted.
+func (g *Graph) writeDOT(w io.Writer, tables []string) error {
+	fmt.Fprintln(w, "digraph pg_rocket {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box, fontname=\"Helvetica\"];")
+	fmt.Fprintln(w, "  edge [fontname=\"Helvetica\", fontsize=10];")
+	fmt.Fprintln(w)
+
+	for _, table := range tables {
+		fmt.Fprintf(w, "  %s;\n", dotQuote(table))
+	}
+	fmt.Fprintln(w)
+
+	for _, edge := range g.Edges(tables) {
+		label := edge.Name + "\n" + ColumnPairs(edge.ForeignKey)
+		if flags := edgeFlags(edge); flags != "" {
+			label += "\n[" + flags + "]"
+		}
+
+		style := "solid"
+		if edge.Virtual {
+			style = "dotted"
+		} else if edge.Nullable {
+			style = "dashed"
+		}
+
+		fmt.Fprintf(w, "  %s -> %s [label=%s, style=%s];\n",
+			dotQuote(edge.ChildTable), dotQuote(edge.ParentTable), dotQuote(label), style)
+	}
+
+	fmt.Fprintln(w, "}")
+	return nil
+}
+
+// dotQuote renders s as a quoted DOT identifier.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// writeMermaid renders the graph as a Mermaid flowchart. Edges point from child
+// to parent; nullable and virtual references use dotted arrows.
+func (g *Graph) writeMermaid(w io.Writer, tables []string) error {
+	fmt.Fprintln(w, "flowchart LR")
+
+	for _, table := range tables {
+		fmt.Fprintf(w, "  %s[\"%s\"]\n", mermaidID(table), mermaidEscape(table))
+	}
+
+	for _, edge := range g.Edges(tables) {
+		label := edge.Name + ": " + ColumnPairs(edge.ForeignKey)
+		if flags := edgeFlags(edge); flags != "" {
+			label += " [" + flags + "]"
+		}
+
+		arrow := "-->"
+		if edge.Nullable || edge.Virtual {
+			arrow = "-.->"
+		}
+
+		fmt.Fprintf(w, "  %s %s|\"%s\"| %s\n",
+			mermaidID(edge.ChildTable), arrow, mermaidEscape(label), mermaidID(edge.ParentTable))
+	}
+
+	return nil
+}
+
+// mermaidID turns a table name into a Mermaid node identifier. Letters and
+// digits are kept, "_" is doubled and any other character becomes its hex code
+// point between underscores (public.users -> public_2e_users), so distinct
+// names never share an identifier.
+func mermaidID(table string) string {
+	var id strings.Builder
+	for _, r := range table {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			id.WriteRune(r)
+		case r == '_':
+			id.WriteString("__")
+		default:
+			fmt.Fprintf(&id, "_%x_", r)
+		}
+	}
+	return id.String()
+}
+
+// mermaidEscape escapes double quotes for use inside a quoted Mermaid label.
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
+
+// jsonGraph is the document written by the json format.
+type jsonGraph struct {
+	Tables      []jsonTable      `json:"tables"`
+	ForeignKeys []jsonForeignKey `json:"foreign_keys"`
+	Cycles      [][]string       `json:"cycles"`
+}
+
+type jsonTable struct {
+	Name       string       `json:"name"`
+	PrimaryKey []string     `json:"primary_key"`
+	Columns    []jsonColumn `json:"columns"`
+}
+
+type jsonColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+type jsonForeignKey struct {
+	Name          string   `json:"name"`
+	ChildTable    string   `json:"child_table"`
+	ChildColumns  []string `json:"child_columns"`
+	ParentTable   string   `json:"parent_table"`
+	ParentColumns []string `json:"parent_columns"`
+	Nullable      bool     `json:"nullable"`
+	SelfReference bool     `json:"self_reference"`
+	Virtual       bool     `json:"virtual"`
+	Deferrable    bool     `json:"deferrable"`
+}
+
+func (g *Graph) writeJSON(w io.Writer, tables []string) error {
+	doc := jsonGraph{
+		Tables:      make([]jsonTable, 0, len(tables)),
+		ForeignKeys: make([]jsonForeignKey, 0),
+		Cycles:      make([][]string, 0),
+	}
+
+	for _, table := range tables {
+		jt := jsonTable{
+			Name:       table,
+			PrimaryKey: g.GetPrimaryKeyColumns(table),
+			Columns:    make([]jsonColumn, 0),
+		}
+		if jt.PrimaryKey == nil {
+			jt.PrimaryKey = []string{}
+		}
+		for _, col := range g.GetColumns(table) {
+			jt.Columns = append(jt.Columns, jsonColumn{Name: col.Name, Type: col.DataType, Nullable: !col.NotNull})
+		}
+		doc.Tables = append(doc.Tables, jt)
+	}
+
+	for _, edge := range g.Edges(tables) {
+		doc.ForeignKeys = append(doc.ForeignKeys, jsonForeignKey{
+			Name:          edge.Name,
+			ChildTable:    edge.ChildTable,
+			ChildColumns:  edge.ChildColumns,
+			ParentTable:   edge.ParentTable,
+			ParentColumns: edge.ParentColumns,
+			Nullable:      edge.Nullable,
+			SelfReference: edge.SelfReference,
+			Virtual:       edge.Virtual,
+			Deferrable:    edge.Deferrable,
+		})
+	}
+
+	for _, component := range g.StronglyConnectedComponents(tables) {
+		if len(component) > 1 {
+			doc.Cycles = append(doc.Cycles, component)
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package graph
+
+import "testing"
+
+func TestMermaidIDIsInjective(t *testing.T) {
+	tables := []string{
+		"public.users",
+		"public_users",
+		"public.users_x",
+		"a.b_c",
+		"a_b.c",
+		"a__b.c",
+		"a_2e_b.c",
+		"a.2e.b",
+		"app.Ünïcode",
+		"app.with space",
+		"app.with_space",
+	}
+
+	seen := make(map[string]string)
+	for _, table := range tables {
+		id := mermaidID(table)
+		for _, r := range id {
+			if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_') {
+				t.Errorf("mermaidID(%q) = %q contains %q", table, id, r)
+			}
+		}
+		if other, ok := seen[id]; ok {
+			t.Errorf("mermaidID(%q) = mermaidID(%q) = %q", table, other, id)
+		}
+		seen[id] = table
+	}
+
+	if got, want := mermaidID("public.users"), "public_2e_users"; got != want {
+		t.Errorf("mermaidID(public.users) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,221 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+)
+
+// PathStep is one hop of a relationship path between two tables.
+type PathStep struct {
+	From       string        // Table the hop starts at
+	To         string        // Table the hop ends at
+	Direction  string        // DirectionUp if From is the child of the FK, DirectionDown if it is the parent
+	ForeignKey db.ForeignKey // Foreign key followed by the hop
+}
+
+// Path is a sequence of hops connecting two tables.
+type Path []PathStep
+
+// FindPaths returns the simple paths (no table visited twice) from one table to
+// another, following foreign keys in either direction. Paths are returned
+// shortest first, then in a deterministic order, with at most maxHops hops each.
+// If limit is positive, only the limit shortest paths are returned.
+// Self-referential foreign keys are ignored since they do not change tables.
+func (g *Graph) FindPaths(from, to string, maxHops, limit int) []Path {
+	if from == to {
+		return nil
+	}
+
+	// Hop distance of every table to the target, used to prune the search
+	distance := map[string]int{to: 0}
+	queue := []string{to}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, step := range g.pathSteps(current) {
+			if _, seen := distance[step.To]; !seen {
+				distance[step.To] = distance[current] + 1
+				queue = append(queue, step.To)
+			}
+		}
+	}
+
+	if _, reachable := distance[from]; !reachable {
+		return nil
+	}
+
+	paths := make([]Path, 0)
+
+	// Enumerate paths of increasing length so the shortest paths come first
+	for length := distance[from]; length <= maxHops; length++ {
+		visited := map[string]bool{from: true}
+		current := make(Path, 0, length)
+
+		var extend func(table string)
+		extend = func(table string) {
+			if len(current) == length {
+				if table == to {
+					found := make(Path, len(current))
+					copy(found, current)
+					paths = append(paths, found)
+				}
+				return
+			}
+
+			for _, step := range g.pathSteps(table) {
+				if visited[step.To] {
+					continue
+				}
+				// Prune tables that cannot reach the target in the remaining hops
+				if d, ok := distance[step.To]; !ok || len(current)+1+d > length {
+					continue
+				}
+
+				visited[step.To] = true
+				current = append(current, step)
+				extend(step.To)
+				current = current[:len(current)-1]
+				visited[step.To] = false
+			}
+		}
+		extend(from)
+
+		if limit > 0 && len(paths) >= limit {
+			return paths[:limit]
+		}
+	}
+
+	return paths
+}
+
+// pathSteps returns the hops leaving table in both directions, ordered by
+// destination table, direction and constraint name.
+func (g *Graph) pathSteps(table string) []PathStep {
+	steps := make([]PathStep, 0)
+
+	for _, fk := range g.GetParents(table) {
+		if fk.ParentTable != table {
+			steps = append(steps, PathStep{From: table, To: fk.ParentTable, Direction: DirectionUp, ForeignKey: fk})
+		}
+	}
+	for _, fk := range g.GetChildren(table) {
+		if fk.ChildTable != table {
+			steps = append(steps, PathStep{From: table, To: fk.ChildTable, Direction: DirectionDown, ForeignKey: fk})
+		}
+	}
+
+	sort.SliceStable(steps, func(i, j int) bool {
+		if steps[i].To != steps[j].To {
+			return steps[i].To < steps[j].To
+		}
+		if steps[i].Direction != steps[j].Direction {
+			return steps[i].Direction > steps[j].Direction // "up" before "down"
+		}
+		return steps[i].ForeignKey.Name < steps[j].ForeignKey.Name
+	})
+
+	return steps
+}
+
+// Columns returns the columns joined by the hop on its From and To tables.
+func (s PathStep) Columns() (from, to []string) {
+	if s.Direction == DirectionUp {
+		return s.ForeignKey.ChildColumns, s.ForeignKey.ParentColumns
+	}
+	return s.ForeignKey.ParentColumns, s.ForeignKey.ChildColumns
+}
+
+// RenderPaths writes the paths between two tables as text or JSON.
+func RenderPaths(w io.Writer, format, from, to string, paths []Path) error {
+	switch format {
+	case FormatText, "":
+		return writePathsText(w, from, to, paths)
+	case FormatJSON:
+		return writePathsJSON(w, from, to, paths)
+	default:
+		return fmt.Errorf("unknown format '%s' (expected text or json)", format)
+	}
+}
+
+func writePathsText(w io.Writer, from, to string, paths []Path) error {
+	if len(paths) == 0 {
+		fmt.Fprintf(w, "No foreign key path from %s to %s\n", from, to)
+		return nil
+	}
+
+	fmt.Fprintf(w, "%d path(s) from %s to %s:\n", len(paths), from, to)
+
+	for i, path := range paths {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Path %d (%d hops):\n", i+1, len(path))
+
+		for _, step := range path {
+			fromColumns, toColumns := step.Columns()
+			arrow, join := "↑", "→"
+			if step.Direction == DirectionDown {
+				arrow, join = "↓", "←"
+			}
+			fmt.Fprintf(w, "  %s %s %s via %s (%s %s %s)%s\n",
+				step.From, arrow, step.To, step.ForeignKey.Name,
+				formatColumns(fromColumns), join, formatColumns(toColumns), virtualMarker(Edge{ForeignKey: step.ForeignKey}))
+		}
+	}
+
+	return nil
+}
+
+// jsonPaths is the document written by the json format of RenderPaths.
+type jsonPaths struct {
+	From  string     `json:"from"`
+	To    string     `json:"to"`
+	Paths []jsonPath `json:"paths"`
+}
+
+type jsonPath struct {
+	Hops  int            `json:"hops"`
+	Steps []jsonPathStep `json:"steps"`
+}
+
+type jsonPathStep struct {
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Direction   string   `json:"direction"`
+	Constraint  string   `json:"constraint"`
+	FromColumns []string `json:"from_columns"`
+	ToColumns   []string `json:"to_columns"`
+	Virtual     bool     `json:"virtual"`
+}
+
+func writePathsJSON(w io.Writer, from, to string, paths []Path) error {
+	doc := jsonPaths{From: from, To: to, Paths: make([]jsonPath, 0, len(paths))}
+
+	for _, path := range paths {
+		jp := jsonPath{Hops: len(path), Steps: make([]jsonPathStep, 0, len(path))}
+		for _, step := range path {
+			fromColumns, toColumns := step.Columns()
+			jp.Steps = append(jp.Steps, jsonPathStep{
+				From:        step.From,
+				To:          step.To,
+				Direction:   step.Direction,
+				Constraint:  step.ForeignKey.Name,
+				FromColumns: fromColumns,
+				ToColumns:   toColumns,
+				Virtual:     step.ForeignKey.Virtual,
+			})
+		}
+		doc.Paths = append(doc.Paths, jp)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+
+	return nil
+}
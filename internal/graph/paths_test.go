@@ -0,0 +1,78 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+// pathHops renders each path as its hops, e.g. "public.a ↑ public.b".
+func pathHops(paths []Path) [][]string {
+	rendered := make([][]string, len(paths))
+	for i, path := range paths {
+		rendered[i] = make([]string, len(path))
+		for j, step := range path {
+			arrow := "↑"
+			if step.Direction == DirectionDown {
+				arrow = "↓"
+			}
+			rendered[i][j] = step.From + " " + arrow + " " + step.To
+		}
+	}
+	return rendered
+}
+
+func newPathsGraph() *Graph {
+	tables := []string{"public.audit", "public.customers", "public.invoices", "public.orders", "public.shipments", "public.warehouses"}
+	return newTestGraph(tables,
+		testFK{child: "public.invoices", column: "order_id", parent: "public.orders"},
+		testFK{child: "public.invoices", column: "customer_id", parent: "public.customers"},
+		testFK{child: "public.orders", column: "warehouse_id", parent: "public.warehouses"},
+		testFK{child: "public.orders", column: "parent_id", parent: "public.orders", nullable: true},
+		testFK{child: "public.shipments", column: "order_id", parent: "public.orders"},
+		testFK{child: "public.shipments", column: "warehouse_id", parent: "public.warehouses"},
+	)
+}
+
+func TestFindPathsShortestFirst(t *testing.T) {
+	g := newPathsGraph()
+
+	paths := g.FindPaths("public.invoices", "public.warehouses", 4, 0)
+
+	want := [][]string{
+		{"public.invoices ↑ public.orders", "public.orders ↑ public.warehouses"},
+		{"public.invoices ↑ public.orders", "public.orders ↓ public.shipments", "public.shipments ↑ public.warehouses"},
+	}
+	if got := pathHops(paths); !reflect.DeepEqual(got, want) {
+		t.Errorf("FindPaths = %v, want %v", got, want)
+	}
+
+	from, to := paths[1][1].Columns()
+	if !reflect.DeepEqual(from, []string{"id"}) || !reflect.DeepEqual(to, []string{"order_id"}) {
+		t.Errorf("Columns of the down hop = %v, %v; want [id], [order_id]", from, to)
+	}
+}
+
+func TestFindPathsLimits(t *testing.T) {
+	g := newPathsGraph()
+
+	if got := pathHops(g.FindPaths("public.invoices", "public.warehouses", 4, 1)); len(got) != 1 || len(got[0]) != 2 {
+		t.Errorf("FindPaths with limit 1 = %v, want the 2-hop path only", got)
+	}
+	if got := g.FindPaths("public.invoices", "public.warehouses", 2, 0); len(got) != 1 {
+		t.Errorf("FindPaths with 2 hops = %v, want 1 path", pathHops(got))
+	}
+	if got := g.FindPaths("public.invoices", "public.warehouses", 1, 0); len(got) != 0 {
+		t.Errorf("FindPaths with 1 hop = %v, want none", pathHops(got))
+	}
+}
+
+func TestFindPathsUnreachable(t *testing.T) {
+	g := newPathsGraph()
+
+	if got := g.FindPaths("public.invoices", "public.audit", 10, 0); len(got) != 0 {
+		t.Errorf("FindPaths to an unconnected table = %v, want none", pathHops(got))
+	}
+	if got := g.FindPaths("public.orders", "public.orders", 10, 0); len(got) != 0 {
+		t.Errorf("FindPaths to the same table = %v, want none", pathHops(got))
+	}
+}
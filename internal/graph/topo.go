@@ -3,45 +3,179 @@ package graph
 import (
 	"fmt"
 	"sort"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
 )
 
-// TopologicalSort performs a topological sort on the given tables using Kahn's algorithm.
-// Returns tables ordered such that parent tables appear before their children,
-// ensuring INSERT statements can be executed in order without FK violations.
+// InsertPlan describes how to insert a set of tables so that every foreign key
+// is satisfied, including tables that take part in multi-table FK cycles.
+type InsertPlan struct {
+	Order     []string        // Tables in insert order (parents before children where possible)
+	Deferred  []db.ForeignKey // Cycle FKs whose DEFERRABLE constraints are checked at commit time
+	Postponed []db.ForeignKey // Cycle FKs inserted as NULL and set by a follow-up UPDATE
+}
+
+// TopologicalSort orders the given tables such that parent tables appear before
+// their children, ensuring INSERT statements can be executed in order without FK
+// violations. Tables in a multi-table cycle are ordered as described in PlanInserts.
 // Self-referential foreign keys are automatically excluded from the dependency graph.
 func (g *Graph) TopologicalSort(tables []string) ([]string, error) {
-	inDegree := make(map[string]int)
-	adjList := make(map[string][]string)
+	plan, err := g.PlanInserts(tables)
+	if err != nil {
+		return nil, err
+	}
+	return plan.Order, nil
+}
 
+// PlanInserts computes the insert order for the given tables. Strongly connected
+// components are ordered with Kahn's algorithm, so tables outside cycles keep
+// parents-before-children order. Within a cycle, tables are ordered by the FKs
+// that cannot be broken (NOT NULL and not DEFERRABLE); the remaining FKs that
+// point forward in the order are deferred to commit time if DEFERRABLE, or
+// postponed to a follow-up UPDATE otherwise. Virtual FKs are not enforced by
+// the database and never need breaking. Returns an error if a cycle consists
+// only of FKs that cannot be broken.
+func (g *Graph) PlanInserts(tables []string) (*InsertPlan, error) {
 	tableSet := make(map[string]bool)
 	for _, table := range tables {
 		tableSet[table] = true
-		inDegree[table] = 0
 	}
 
+	components := g.StronglyConnectedComponents(tables)
+
+	// Each component is represented by its first (alphabetically smallest) table
+	componentOf := make(map[string]string)
+	members := make(map[string][]string)
+	names := make([]string, 0, len(components))
+	for _, component := range components {
+		name := component[0]
+		names = append(names, name)
+		members[name] = component
+		for _, table := range component {
+			componentOf[table] = name
+		}
+	}
+
+	dependencies := make(map[string][]string)
 	for _, table := range tables {
 		for _, fk := range g.Parents[table] {
 			// Skip self-referential foreign keys (e.g., users.manager_id -> users.id)
-			if fk.ParentTable == table {
+			if fk.ParentTable == table || !tableSet[fk.ParentTable] {
 				continue
 			}
-			if tableSet[fk.ParentTable] {
-				adjList[fk.ParentTable] = append(adjList[fk.ParentTable], table)
-				inDegree[table]++
+			child, parent := componentOf[table], componentOf[fk.ParentTable]
+			if child != parent {
+				dependencies[child] = append(dependencies[child], parent)
 			}
 		}
 	}
 
+	componentOrder := kahnOrder(names, dependencies)
+	if len(componentOrder) != len(names) {
+		// Cannot happen: the component graph is acyclic by construction
+		return nil, fmt.Errorf("cycle detected in table dependencies")
+	}
+
+	plan := &InsertPlan{Order: make([]string, 0, len(tables))}
+	for _, name := range componentOrder {
+		ordered, err := g.orderCycle(members[name])
+		if err != nil {
+			return nil, err
+		}
+		plan.Order = append(plan.Order, ordered...)
+	}
+
+	position := make(map[string]int)
+	for i, table := range plan.Order {
+		position[table] = i
+	}
+
+	for _, table := range plan.Order {
+		for _, fk := range g.Parents[table] {
+			if fk.ParentTable == table || !tableSet[fk.ParentTable] || fk.Virtual {
+				continue
+			}
+			if componentOf[fk.ParentTable] != componentOf[table] || position[fk.ParentTable] < position[table] {
+				continue
+			}
+
+			if fk.Deferrable {
+				plan.Deferred = append(plan.Deferred, fk)
+			} else {
+				plan.Postponed = append(plan.Postponed, fk)
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// orderCycle orders the tables of one strongly connected component. Only FKs
+// that cannot be broken constrain the order; single tables are returned as-is.
+func (g *Graph) orderCycle(component []string) ([]string, error) {
+	if len(component) == 1 {
+		return component, nil
+	}
+
+	inComponent := make(map[string]bool)
+	for _, table := range component {
+		inComponent[table] = true
+	}
+
+	dependencies := make(map[string][]string)
+	for _, table := range component {
+		for _, fk := range g.Parents[table] {
+			if fk.ParentTable == table || !inComponent[fk.ParentTable] {
+				continue
+			}
+			if fk.Virtual || fk.Deferrable || g.IsNullable(table, fk.ChildColumns) {
+				continue
+			}
+			dependencies[table] = append(dependencies[table], fk.ParentTable)
+		}
+	}
+
+	ordered := kahnOrder(component, dependencies)
+	if len(ordered) != len(component) {
+		return nil, fmt.Errorf("cannot break foreign key cycle between %v: every foreign key in the cycle is NOT NULL and not DEFERRABLE", component)
+	}
+
+	return ordered, nil
+}
+
+// kahnOrder orders nodes with Kahn's algorithm so that every node comes after the
+// nodes it depends on, breaking ties alphabetically. Nodes that are part of a
+// dependency cycle are left out of the result.
+func kahnOrder(nodes []string, dependencies map[string][]string) []string {
+	inDegree := make(map[string]int)
+	adjList := make(map[string][]string)
+
+	for _, node := range nodes {
+		inDegree[node] = 0
+	}
+
+	for _, node := range nodes {
+		seen := make(map[string]bool)
+		for _, dependency := range dependencies[node] {
+			if seen[dependency] {
+				continue
+			}
+			seen[dependency] = true
+			adjList[dependency] = append(adjList[dependency], node)
+			inDegree[node]++
+		}
+	}
+
 	queue := make([]string, 0)
-	for _, table := range tables {
-		if inDegree[table] == 0 {
-			queue = append(queue, table)
+	for _, node := range nodes {
+		if inDegree[node] == 0 {
+			queue = append(queue, node)
 		}
 	}
 
 	sort.Strings(queue)
 
-	result := make([]string, 0, len(tables))
+	result := make([]string, 0, len(nodes))
 
 	for len(queue) > 0 {
 		current := queue[0]
@@ -60,16 +194,5 @@ func (g *Graph) TopologicalSort(tables []string) ([]string, error) {
 		}
 	}
 
-	if len(result) != len(tables) {
-		remaining := make([]string, 0)
-		for table := range inDegree {
-			if inDegree[table] > 0 {
-				remaining = append(remaining, table)
-			}
-		}
-		sort.Strings(remaining)
-		return nil, fmt.Errorf("cycle detected in table dependencies involving: %v", remaining)
-	}
-
-	return result, nil
+	return result
 }
@@ -0,0 +1,179 @@
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+)
+
+// testFK is a single-column foreign key from child.column to parent.id.
+type testFK struct {
+	child, column, parent string
+	nullable, deferrable  bool
+	virtual               bool
+}
+
+// newTestGraph builds a graph of tables with an id primary key and a column
+// per foreign key.
+func newTestGraph(tables []string, fks ...testFK) *Graph {
+	metadata := &db.Metadata{
+		Parents:    make(map[string][]db.ForeignKey),
+		Children:   make(map[string][]db.ForeignKey),
+		PrimaryKey: make(map[string][]string),
+		UniqueKeys: make(map[string][][]string),
+		Columns:    make(map[string][]db.Column),
+	}
+
+	for _, table := range tables {
+		metadata.PrimaryKey[table] = []string{"id"}
+		metadata.Columns[table] = []db.Column{{Name: "id", DataType: "integer", NotNull: true}}
+	}
+
+	for _, tfk := range fks {
+		fk := db.ForeignKey{
+			Name:          tfk.child + "_" + tfk.column + "_fkey",
+			ChildTable:    tfk.child,
+			ChildColumns:  []string{tfk.column},
+			ParentTable:   tfk.parent,
+			ParentColumns: []string{"id"},
+			Virtual:       tfk.virtual,
+			Deferrable:    tfk.deferrable,
+		}
+		metadata.Parents[fk.ChildTable] = append(metadata.Parents[fk.ChildTable], fk)
+		metadata.Children[fk.ParentTable] = append(metadata.Children[fk.ParentTable], fk)
+		metadata.Columns[fk.ChildTable] = append(metadata.Columns[fk.ChildTable],
+			db.Column{Name: tfk.column, DataType: "integer", NotNull: !tfk.nullable})
+	}
+
+	return NewGraph(metadata)
+}
+
+func fkNames(fks []db.ForeignKey) []string {
+	names := make([]string, len(fks))
+	for i, fk := range fks {
+		names[i] = fk.Name
+	}
+	return names
+}
+
+func TestPlanInsertsWithoutCycles(t *testing.T) {
+	tables := []string{"public.comments", "public.orgs", "public.users"}
+	g := newTestGraph(tables,
+		testFK{child: "public.users", column: "org_id", parent: "public.orgs"},
+		testFK{child: "public.comments", column: "user_id", parent: "public.users"},
+		testFK{child: "public.users", column: "manager_id", parent: "public.users", nullable: true},
+	)
+
+	plan, err := g.PlanInserts(tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"public.orgs", "public.users", "public.comments"}
+	if !reflect.DeepEqual(plan.Order, want) {
+		t.Errorf("Order = %v, want %v", plan.Order, want)
+	}
+	if len(plan.Deferred) != 0 || len(plan.Postponed) != 0 {
+		t.Errorf("Deferred = %v, Postponed = %v; want none", fkNames(plan.Deferred), fkNames(plan.Postponed))
+	}
+}
+
+func TestPlanInsertsDefersDeferrableForeignKey(t *testing.T) {
+	tables := []string{"public.teams", "public.users"}
+	g := newTestGraph(tables,
+		testFK{child: "public.users", column: "team_id", parent: "public.teams", deferrable: true},
+		testFK{child: "public.teams", column: "owner_id", parent: "public.users"},
+	)
+
+	plan, err := g.PlanInserts(tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"public.users", "public.teams"}; !reflect.DeepEqual(plan.Order, want) {
+		t.Errorf("Order = %v, want %v", plan.Order, want)
+	}
+	if want := []string{"public.users_team_id_fkey"}; !reflect.DeepEqual(fkNames(plan.Deferred), want) {
+		t.Errorf("Deferred = %v, want %v", fkNames(plan.Deferred), want)
+	}
+	if len(plan.Postponed) != 0 {
+		t.Errorf("Postponed = %v, want none", fkNames(plan.Postponed))
+	}
+}
+
+func TestPlanInsertsPostponesNullableForeignKey(t *testing.T) {
+	tables := []string{"public.teams", "public.users"}
+	g := newTestGraph(tables,
+		testFK{child: "public.users", column: "default_team_id", parent: "public.teams", nullable: true},
+		testFK{child: "public.teams", column: "owner_id", parent: "public.users"},
+	)
+
+	plan, err := g.PlanInserts(tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"public.users", "public.teams"}; !reflect.DeepEqual(plan.Order, want) {
+		t.Errorf("Order = %v, want %v", plan.Order, want)
+	}
+	if want := []string{"public.users_default_team_id_fkey"}; !reflect.DeepEqual(fkNames(plan.Postponed), want) {
+		t.Errorf("Postponed = %v, want %v", fkNames(plan.Postponed), want)
+	}
+	if len(plan.Deferred) != 0 {
+		t.Errorf("Deferred = %v, want none", fkNames(plan.Deferred))
+	}
+}
+
+func TestPlanInsertsIgnoresVirtualForeignKeyInCycle(t *testing.T) {
+	tables := []string{"public.teams", "public.users"}
+	g := newTestGraph(tables,
+		testFK{child: "public.users", column: "team_id", parent: "public.teams", virtual: true},
+		testFK{child: "public.teams", column: "owner_id", parent: "public.users"},
+	)
+
+	plan, err := g.PlanInserts(tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"public.users", "public.teams"}; !reflect.DeepEqual(plan.Order, want) {
+		t.Errorf("Order = %v, want %v", plan.Order, want)
+	}
+	if len(plan.Deferred) != 0 || len(plan.Postponed) != 0 {
+		t.Errorf("Deferred = %v, Postponed = %v; want none", fkNames(plan.Deferred), fkNames(plan.Postponed))
+	}
+}
+
+func TestPlanInsertsRejectsUnbreakableCycle(t *testing.T) {
+	tables := []string{"public.a", "public.b", "public.c"}
+	g := newTestGraph(tables,
+		testFK{child: "public.a", column: "b_id", parent: "public.b"},
+		testFK{child: "public.b", column: "c_id", parent: "public.c"},
+		testFK{child: "public.c", column: "a_id", parent: "public.a"},
+	)
+
+	_, err := g.PlanInserts(tables)
+	if err == nil || !strings.Contains(err.Error(), "cannot break foreign key cycle") {
+		t.Fatalf("PlanInserts error = %v, want an unbreakable cycle error", err)
+	}
+}
+
+func TestPlanInsertsOrdersCycleAfterItsParents(t *testing.T) {
+	tables := []string{"public.orgs", "public.teams", "public.users"}
+	g := newTestGraph(tables,
+		testFK{child: "public.users", column: "org_id", parent: "public.orgs"},
+		testFK{child: "public.users", column: "team_id", parent: "public.teams", nullable: true},
+		testFK{child: "public.teams", column: "owner_id", parent: "public.users"},
+	)
+
+	plan, err := g.PlanInserts(tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"public.orgs", "public.users", "public.teams"}; !reflect.DeepEqual(plan.Order, want) {
+		t.Errorf("Order = %v, want %v", plan.Order, want)
+	}
+}
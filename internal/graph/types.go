@@ -4,15 +4,20 @@
 package graph
 
 import (
+	"sort"
+
 	"github.com/riyasyash/pg_rocket/internal/db"
 )
 
 // Graph represents the foreign key relationship structure of a database schema.
-// It maintains bidirectional FK relationships and primary key information.
+// It maintains bidirectional FK relationships, primary key and column information.
+// Tables are keyed by their schema-qualified name ("schema.table").
 type Graph struct {
 	Parents    map[string][]db.ForeignKey // FK relationships pointing to parent tables
 	Children   map[string][]db.ForeignKey // FK relationships pointing to child tables
 	PrimaryKey map[string][]string        // Primary key columns per table (supports composite PKs)
+	UniqueKeys map[string][][]string      // NOT NULL unique keys per table, used when there is no PK
+	Columns    map[string][]db.Column     // Columns per table in ordinal order
 }
 
 // NewGraph creates a new Graph from extracted database metadata.
@@ -21,6 +26,8 @@ func NewGraph(metadata *db.Metadata) *Graph {
 		Parents:    metadata.Parents,
 		Children:   metadata.Children,
 		PrimaryKey: metadata.PrimaryKey,
+		UniqueKeys: metadata.UniqueKeys,
+		Columns:    metadata.Columns,
 	}
 }
 
@@ -34,18 +41,130 @@ func (g *Graph) GetChildren(table string) []db.ForeignKey {
 	return g.Children[table]
 }
 
-// GetPrimaryKey returns the first primary key column for backward compatibility.
-// For composite primary keys, use GetPrimaryKeyColumns instead.
-func (g *Graph) GetPrimaryKey(table string) string {
-	pks := g.PrimaryKey[table]
-	if len(pks) > 0 {
-		return pks[0]
-	}
-	return ""
-}
-
 // GetPrimaryKeyColumns returns all primary key columns for the given table.
 // This supports both single-column and composite primary keys.
 func (g *Graph) GetPrimaryKeyColumns(table string) []string {
 	return g.PrimaryKey[table]
 }
+
+// GetRowKeyColumns returns the columns that identify a row of the given table:
+// the primary key, or the first NOT NULL unique key for tables without one.
+// It returns nil for keyless tables, whose rows are identified by all columns.
+func (g *Graph) GetRowKeyColumns(table string) []string {
+	if pks := g.PrimaryKey[table]; len(pks) > 0 {
+		return pks
+	}
+	if uniques := g.UniqueKeys[table]; len(uniques) > 0 {
+		return uniques[0]
+	}
+	return nil
+}
+
+// GetColumns returns the columns of the given table in ordinal order.
+func (g *Graph) GetColumns(table string) []db.Column {
+	return g.Columns[table]
+}
+
+// Tables returns all known tables of the graph in alphabetical order.
+func (g *Graph) Tables() []string {
+	tableSet := make(map[string]bool)
+	for table := range g.Columns {
+		tableSet[table] = true
+	}
+	for table := range g.Parents {
+		tableSet[table] = true
+	}
+	for table := range g.Children {
+		tableSet[table] = true
+	}
+
+	tables := make([]string, 0, len(tableSet))
+	for table := range tableSet {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// IsNullable reports whether all of the given columns of table accept NULL.
+func (g *Graph) IsNullable(table string, columns []string) bool {
+	notNull := make(map[string]bool)
+	for _, col := range g.Columns[table] {
+		notNull[col.Name] = col.NotNull
+	}
+
+	for _, col := range columns {
+		if notNull[col] {
+			return false
+		}
+	}
+	return true
+}
+
+// Traversal directions for Neighbourhood.
+const (
+	DirectionUp   = "up"   // Follow foreign keys to parent tables
+	DirectionDown = "down" // Follow foreign keys to child tables
+	DirectionBoth = "both" // Union of up and down
+)
+
+// Neighbourhood returns the tables reachable from table within depth hops,
+// sorted by name and including table itself. Direction "up" follows parent
+// edges, "down" follows child edges and "both" returns the union of the two
+// (it does not turn around, so siblings are not included). A negative depth
+// means unlimited.
+func (g *Graph) Neighbourhood(table string, depth int, direction string) []string {
+	reached := map[string]bool{table: true}
+
+	if direction == DirectionUp || direction == DirectionBoth {
+		g.reachable(table, depth, func(t string) []string {
+			parents := make([]string, 0)
+			for _, fk := range g.GetParents(t) {
+				parents = append(parents, fk.ParentTable)
+			}
+			return parents
+		}, reached)
+	}
+
+	if direction == DirectionDown || direction == DirectionBoth {
+		g.reachable(table, depth, func(t string) []string {
+			children := make([]string, 0)
+			for _, fk := range g.GetChildren(t) {
+				children = append(children, fk.ChildTable)
+			}
+			return children
+		}, reached)
+	}
+
+	tables := make([]string, 0, len(reached))
+	for t := range reached {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// reachable runs a breadth-first search from start over next, adding every
+// table within depth hops to reached.
+func (g *Graph) reachable(start string, depth int, next func(string) []string, reached map[string]bool) {
+	distance := map[string]int{start: 0}
+	queue := []string{start}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if depth >= 0 && distance[current] >= depth {
+			continue
+		}
+
+		for _, neighbour := range next(current) {
+			if _, seen := distance[neighbour]; seen {
+				continue
+			}
+			distance[neighbour] = distance[current] + 1
+			reached[neighbour] = true
+			queue = append(queue, neighbour)
+		}
+	}
+}
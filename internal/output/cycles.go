@@ -0,0 +1,58 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+	"github.com/riyasyash/pg_rocket/internal/graph"
+)
+
+// postponedColumns returns, per child table, the FK columns that are inserted
+// as NULL and restored by a follow-up UPDATE to break foreign key cycles.
+func postponedColumns(plan *graph.InsertPlan) map[string]map[string]bool {
+	columns := make(map[string]map[string]bool)
+	for _, fk := range plan.Postponed {
+		if columns[fk.ChildTable] == nil {
+			columns[fk.ChildTable] = make(map[string]bool)
+		}
+		for _, col := range fk.ChildColumns {
+			columns[fk.ChildTable][col] = true
+		}
+	}
+	return columns
+}
+
+// postponedUpdate builds the UPDATE statement that restores the columns of a
+// postponed foreign key for one row. The row is located by its row key or, for
+// keyless tables, by all columns that were not inserted as NULL. render turns a
+// value into SQL text, either a literal or a bind placeholder. It returns false
+// if the row does not reference a parent, in which case there is nothing to restore.
+func postponedUpdate(g *graph.Graph, fk db.ForeignKey, row map[string]interface{}, nulled map[string]bool, render func(interface{}) string) (string, bool) {
+	if _, ok := tupleKey(row, fk.ChildColumns); !ok {
+		return "", false
+	}
+
+	setClauses := make([]string, len(fk.ChildColumns))
+	for i, col := range fk.ChildColumns {
+		setClauses[i] = fmt.Sprintf("%s = %s", col, render(row[col]))
+	}
+
+	whereClauses := make([]string, 0)
+	if keyColumns := g.GetRowKeyColumns(fk.ChildTable); len(keyColumns) > 0 {
+		for _, col := range keyColumns {
+			whereClauses = append(whereClauses, fmt.Sprintf("%s = %s", col, render(row[col])))
+		}
+	} else {
+		for _, col := range sortedColumns(row) {
+			if !nulled[col] {
+				whereClauses = append(whereClauses, fmt.Sprintf("%s IS NOT DISTINCT FROM %s", col, render(row[col])))
+			}
+		}
+	}
+
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+		db.QuoteTable(fk.ChildTable),
+		strings.Join(setClauses, ", "),
+		strings.Join(whereClauses, " AND ")), true
+}
@@ -0,0 +1,65 @@
+package output
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+	"github.com/riyasyash/pg_rocket/internal/graph"
+)
+
+var teamFK = db.ForeignKey{
+	Name:          "users_team_id_fkey",
+	ChildTable:    "public.users",
+	ChildColumns:  []string{"team_id"},
+	ParentTable:   "public.teams",
+	ParentColumns: []string{"id"},
+}
+
+func newCycleGraph(primaryKey []string) *graph.Graph {
+	return graph.NewGraph(&db.Metadata{
+		PrimaryKey: map[string][]string{"public.users": primaryKey},
+		Columns: map[string][]db.Column{
+			"public.users": {{Name: "id", NotNull: true}, {Name: "name"}, {Name: "team_id"}},
+		},
+	})
+}
+
+func TestPostponedColumns(t *testing.T) {
+	plan := &graph.InsertPlan{Postponed: []db.ForeignKey{teamFK}}
+
+	want := map[string]map[string]bool{"public.users": {"team_id": true}}
+	if got := postponedColumns(plan); !reflect.DeepEqual(got, want) {
+		t.Errorf("postponedColumns = %v, want %v", got, want)
+	}
+}
+
+func TestPostponedUpdate(t *testing.T) {
+	nulled := map[string]bool{"team_id": true}
+	row := map[string]interface{}{"id": int64(1), "name": "Alice", "team_id": int64(7)}
+
+	got, ok := postponedUpdate(newCycleGraph([]string{"id"}), teamFK, row, nulled, formatValue)
+	want := `UPDATE "public"."users" SET team_id = 7 WHERE id = 1`
+	if !ok || got != want {
+		t.Errorf("postponedUpdate = %q, %v; want %q, true", got, ok, want)
+	}
+}
+
+func TestPostponedUpdateOfKeylessTable(t *testing.T) {
+	nulled := map[string]bool{"team_id": true}
+	row := map[string]interface{}{"id": int64(1), "name": nil, "team_id": int64(7)}
+
+	got, ok := postponedUpdate(newCycleGraph(nil), teamFK, row, nulled, formatValue)
+	want := `UPDATE "public"."users" SET team_id = 7 WHERE id IS NOT DISTINCT FROM 1 AND name IS NOT DISTINCT FROM NULL`
+	if !ok || got != want {
+		t.Errorf("postponedUpdate = %q, %v; want %q, true", got, ok, want)
+	}
+}
+
+func TestPostponedUpdateWithoutReference(t *testing.T) {
+	row := map[string]interface{}{"id": int64(1), "name": "Alice", "team_id": nil}
+
+	if got, ok := postponedUpdate(newCycleGraph([]string{"id"}), teamFK, row, nil, formatValue); ok {
+		t.Errorf("postponedUpdate = %q, want no statement for a NULL reference", got)
+	}
+}
@@ -3,10 +3,12 @@ package output
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/riyasyash/pg_rocket/internal/db"
 	"github.com/riyasyash/pg_rocket/internal/extractor"
 	"github.com/riyasyash/pg_rocket/internal/graph"
 )
@@ -33,6 +35,9 @@ func NewExecutor(conn *pgx.Conn, g *graph.Graph, verbose bool, upsertMode bool)
 
 // Execute inserts the extracted data into the target database within a transaction.
 // All tables are inserted in topological order (parents before children).
+// Foreign key cycles are broken by deferring DEFERRABLE constraints to commit
+// time, or by inserting nullable FK columns as NULL and restoring them with
+// UPDATEs once every table of the cycle has been inserted.
 // Foreign key integrity is validated before insertion.
 // If any insertion fails, the entire transaction is rolled back.
 func (e *Executor) Execute(ctx context.Context, state *extractor.TraversalState) error {
@@ -43,11 +48,16 @@ func (e *Executor) Execute(ctx context.Context, state *extractor.TraversalState)
 
 	tables := state.GetAllTables()
 
-	sortedTables, err := e.graph.TopologicalSort(tables)
+	plan, err := e.graph.PlanInserts(tables)
 	if err != nil {
 		return fmt.Errorf("failed to sort tables: %w", err)
 	}
 
+	prepared, err := prepareRows(e.graph, state, plan)
+	if err != nil {
+		return err
+	}
+
 	tx, err := e.conn.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
@@ -58,81 +68,125 @@ func (e *Executor) Execute(ctx context.Context, state *extractor.TraversalState)
 		fmt.Println("Starting direct database insertion...")
 	}
 
+	if len(plan.Deferred) > 0 {
+		if _, err := tx.Exec(ctx, "SET CONSTRAINTS ALL DEFERRED"); err != nil {
+			return fmt.Errorf("failed to defer constraints: %w", err)
+		}
+	}
+
+	nullColumns := postponedColumns(plan)
+
 	totalInserted := 0
-	for _, tableName := range sortedTables {
-		rows := state.TableData[tableName]
-		if len(rows) == 0 {
+	for _, tableName := range plan.Order {
+		count := state.Rows.Len(tableName)
+		if count == 0 {
 			continue
 		}
 
-		if err := e.insertTable(ctx, tx, tableName, rows); err != nil {
+		if err := e.insertTable(ctx, tx, state, prepared, tableName, nullColumns[tableName]); err != nil {
 			return fmt.Errorf("failed to insert into %s: %w", tableName, err)
 		}
 
-		totalInserted += len(rows)
+		totalInserted += count
 		if e.verbose {
-			fmt.Printf("Inserted %d rows into %s\n", len(rows), tableName)
+			fmt.Printf("Inserted %d rows into %s\n", count, tableName)
 		}
 	}
 
+	if err := e.restorePostponed(ctx, tx, state, prepared, plan, nullColumns); err != nil {
+		return err
+	}
+
 	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
 	if e.verbose {
-		fmt.Printf("Successfully inserted %d total rows into %d tables\n", totalInserted, len(sortedTables))
+		fmt.Printf("Successfully inserted %d total rows into %d tables\n", totalInserted, len(plan.Order))
 	}
 
 	return nil
 }
 
-// validateForeignKeys checks that all foreign key references point to extracted rows
-func (e *Executor) validateForeignKeys(state *extractor.TraversalState) error {
-	missingRefs := make(map[string][]string) // table -> list of missing parent tables
+// restorePostponed sets the FK columns that were inserted as NULL to break
+// cycles back to their extracted values.
+func (e *Executor) restorePostponed(ctx context.Context, tx pgx.Tx, state *extractor.TraversalState, prepared map[string][]int, plan *graph.InsertPlan, nullColumns map[string]map[string]bool) error {
+	for _, fk := range plan.Postponed {
+		updated := 0
+		err := forEachRow(state, prepared, fk.ChildTable, func(_ int, row map[string]interface{}) error {
+			args := make([]interface{}, 0)
+			render := func(value interface{}) string {
+				args = append(args, value)
+				return fmt.Sprintf("$%d", len(args))
+			}
 
-	for tableName, rows := range state.TableData {
-		if len(rows) == 0 {
-			continue
+			query, ok := postponedUpdate(e.graph, fk, row, nullColumns[fk.ChildTable], render)
+			if !ok {
+				return nil
+			}
+
+			if _, err := tx.Exec(ctx, query, args...); err != nil {
+				return fmt.Errorf("failed to restore %s on %s: %w", fk.Name, fk.ChildTable, err)
+			}
+			updated++
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 
+		if e.verbose && updated > 0 {
+			fmt.Printf("Restored %d rows of %s via %s\n", updated, fk.ChildTable, fk.Name)
+		}
+	}
+
+	return nil
+}
+
+// validateForeignKeys checks that all foreign key references point to extracted rows.
+// References are matched on the actual referenced columns of each constraint,
+// which may be a unique key rather than the parent's primary key.
+func (e *Executor) validateForeignKeys(state *extractor.TraversalState) error {
+	missingRefs := make(map[string][]string) // table -> list of missing parent references
+
+	for _, tableName := range state.Rows.Tables() {
 		// Check each foreign key for this table
 		for _, fk := range e.graph.Parents[tableName] {
 			parentTable := fk.ParentTable
 
-			// Skip self-referential FKs (they're handled specially)
-			if parentTable == tableName {
+			// Virtual FKs are not enforced by the target database, and parents
+			// excluded from traversal are assumed present (see AssumedPresent)
+			if fk.Virtual || state.Options.Excludes(fk) {
 				continue
 			}
 
-			// Check if parent table was extracted
-			if _, exists := state.TableData[parentTable]; !exists {
-				// Parent table not extracted at all
-				if missingRefs[tableName] == nil {
-					missingRefs[tableName] = []string{}
-				}
-				missingRefs[tableName] = append(missingRefs[tableName], parentTable)
-				continue
+			// Rows whose reference is NULL need no parent, even if none of the
+			// parent table was extracted
+			missing, err := missingParents(e.graph, state, fk)
+			if err != nil {
+				return err
 			}
 
-			// Check if all FK values exist in parent table
-			parentRows := state.TableData[parentTable]
-			if len(parentRows) == 0 {
-				// Parent table exists but has no rows
-				if missingRefs[tableName] == nil {
-					missingRefs[tableName] = []string{}
-				}
-				missingRefs[tableName] = append(missingRefs[tableName], parentTable)
+			if missing > 0 {
+				missingRefs[tableName] = append(missingRefs[tableName],
+					fmt.Sprintf("%s (%d rows via %s)", parentTable, missing, fk.Name))
 			}
 		}
 	}
 
 	if len(missingRefs) > 0 {
+		tables := make([]string, 0, len(missingRefs))
+		for table := range missingRefs {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+
 		var errorMsg strings.Builder
-		errorMsg.WriteString("foreign key integrity violation: some extracted rows reference parent tables that were not extracted:\n\n")
+		errorMsg.WriteString("foreign key integrity violation: some extracted rows reference parent rows that were not extracted:\n\n")
 
-		for table, parents := range missingRefs {
-			errorMsg.WriteString(fmt.Sprintf("  • Table '%s' references missing parent table(s): %s\n",
-				table, strings.Join(parents, ", ")))
+		for _, table := range tables {
+			errorMsg.WriteString(fmt.Sprintf("  • Table '%s' references missing parent(s): %s\n",
+				table, strings.Join(missingRefs[table], ", ")))
 		}
 
 		errorMsg.WriteString("\nThis usually means the FK graph traversal didn't include all necessary parent tables.\n")
@@ -144,42 +198,110 @@ func (e *Executor) validateForeignKeys(state *extractor.TraversalState) error {
 	return nil
 }
 
-func (e *Executor) insertTable(ctx context.Context, tx pgx.Tx, tableName string, rows []map[string]interface{}) error {
-	if len(rows) == 0 {
-		return nil
+// missingParents counts the rows of fk's child table whose reference through
+// fk matches no extracted parent row. References to the parent's row key are
+// looked up in the store; other references, to a unique key, are matched
+// against the set of that key's values.
+func missingParents(g *graph.Graph, state *extractor.TraversalState, fk db.ForeignKey) (int, error) {
+	present := func(row map[string]interface{}) (bool, error) {
+		key := make(map[string]interface{}, len(fk.ParentColumns))
+		for i, col := range fk.ParentColumns {
+			key[col] = row[fk.ChildColumns[i]]
+		}
+		return state.HasRow(fk.ParentTable, key)
+	}
+
+	if !slices.Equal(fk.ParentColumns, g.GetRowKeyColumns(fk.ParentTable)) {
+		parentKeys := make(map[string]bool)
+		err := forEachRow(state, nil, fk.ParentTable, func(_ int, row map[string]interface{}) error {
+			if key, ok := tupleKey(row, fk.ParentColumns); ok {
+				parentKeys[key] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		present = func(row map[string]interface{}) (bool, error) {
+			key, _ := tupleKey(row, fk.ChildColumns)
+			return parentKeys[key], nil
+		}
 	}
 
-	pkColumns := e.graph.GetPrimaryKeyColumns(tableName)
+	missing := 0
+	err := forEachRow(state, nil, fk.ChildTable, func(_ int, row map[string]interface{}) error {
+		if _, ok := tupleKey(row, fk.ChildColumns); !ok {
+			return nil
+		}
+
+		found, err := present(row)
+		if err != nil {
+			return err
+		}
+		if !found {
+			missing++
+		}
+		return nil
+	})
+
+	return missing, err
+}
+
+// insertTable inserts the rows of tableName, streaming them in output order
+// (see forEachRow). Columns in nullColumns are inserted as NULL; they belong
+// to foreign keys postponed to break a cycle.
+func (e *Executor) insertTable(ctx context.Context, tx pgx.Tx, state *extractor.TraversalState, prepared map[string][]int, tableName string, nullColumns map[string]bool) error {
+	var columns []string
+	var query string
+
+	return forEachRow(state, prepared, tableName, func(i int, row map[string]interface{}) error {
+		// Rows arrive sorted by key and in self-reference order (see prepareRows)
+		if i == 0 {
+			columns = sortedColumns(row)
 
-	// Sort by composite PK
-	sort.Slice(rows, func(i, j int) bool {
-		for _, pkCol := range pkColumns {
-			vi := fmt.Sprintf("%v", rows[i][pkCol])
-			vj := fmt.Sprintf("%v", rows[j][pkCol])
-			if vi != vj {
-				return vi < vj
+			var err error
+			if query, err = e.insertQuery(ctx, tx, tableName, columns); err != nil {
+				return err
+			}
+		}
+
+		values := make([]interface{}, len(columns))
+		for j, col := range columns {
+			if !nullColumns[col] {
+				values[j] = row[col]
 			}
 		}
-		return false
+
+		if _, err := tx.Exec(ctx, query, values...); err != nil {
+			return fmt.Errorf("failed to insert row: %w", err)
+		}
+		return nil
 	})
+}
+
+// insertQuery builds the INSERT statement for one row of tableName with the
+// given columns, casting text values of JSONB/JSON columns in the target. In
+// upsert mode, conflicts on the row key update the existing row.
+func (e *Executor) insertQuery(ctx context.Context, tx pgx.Tx, tableName string, columns []string) (string, error) {
+	pkColumns := e.graph.GetRowKeyColumns(tableName)
 
-	columns := make([]string, 0)
-	for col := range rows[0] {
-		columns = append(columns, col)
+	if e.upsertMode && len(pkColumns) == 0 && e.verbose {
+		fmt.Printf("Table %s has no primary or unique key; inserting without conflict handling\n", tableName)
 	}
-	sort.Strings(columns)
 
 	// Detect JSONB/JSON columns in target database FIRST
 	columnQuery := `
 		SELECT column_name, data_type
 		FROM information_schema.columns
-		WHERE table_schema = 'public' 
-		  AND table_name = $1
+		WHERE table_schema = $1
+		  AND table_name = $2
 	`
 
-	colRows, err := tx.Query(ctx, columnQuery, tableName)
+	schemaName, relName := db.SplitQualifiedName(tableName)
+	colRows, err := tx.Query(ctx, columnQuery, schemaName, relName)
 	if err != nil {
-		return fmt.Errorf("failed to get column info for %s: %w", tableName, err)
+		return "", fmt.Errorf("failed to get column info for %s: %w", tableName, err)
 	}
 
 	jsonbCols := make(map[string]string) // column -> datatype
@@ -187,7 +309,7 @@ func (e *Executor) insertTable(ctx context.Context, tx pgx.Tx, tableName string,
 		var colName, dataType string
 		if err := colRows.Scan(&colName, &dataType); err != nil {
 			colRows.Close()
-			return fmt.Errorf("failed to scan column info: %w", err)
+			return "", fmt.Errorf("failed to scan column info: %w", err)
 		}
 		if dataType == "jsonb" || dataType == "json" {
 			jsonbCols[colName] = dataType
@@ -206,9 +328,12 @@ func (e *Executor) insertTable(ctx context.Context, tx pgx.Tx, tableName string,
 		}
 	}
 
+	quotedTable := db.QuoteTable(tableName)
+
 	var query string
-	if e.upsertMode {
-		// Build ON CONFLICT clause for upsert
+	if e.upsertMode && len(pkColumns) > 0 {
+		// Build ON CONFLICT clause for upsert on the primary key, or on the
+		// unique key standing in for it. Keyless tables use plain INSERTs below.
 		conflictCols := make([]string, len(pkColumns))
 		for i, col := range pkColumns {
 			conflictCols[i] = col
@@ -232,7 +357,7 @@ func (e *Executor) insertTable(ctx context.Context, tx pgx.Tx, tableName string,
 		if len(updateSet) > 0 {
 			query = fmt.Sprintf(
 				"INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s",
-				tableName,
+				quotedTable,
 				strings.Join(columns, ", "),
 				strings.Join(placeholders, ", "),
 				strings.Join(conflictCols, ", "),
@@ -242,30 +367,19 @@ func (e *Executor) insertTable(ctx context.Context, tx pgx.Tx, tableName string,
 			// If all columns are PKs, just do nothing on conflict
 			query = fmt.Sprintf(
 				"INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO NOTHING",
-				tableName,
+				quotedTable,
 				strings.Join(columns, ", "),
 				strings.Join(placeholders, ", "),
 				strings.Join(conflictCols, ", "),
 			)
 		}
 	} else {
-		// Standard INSERT (will fail on duplicates)
+		// Standard INSERT (will fail on duplicates, or duplicate rows of keyless tables)
 		query = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
-			tableName,
+			quotedTable,
 			strings.Join(columns, ", "),
 			strings.Join(placeholders, ", "))
 	}
 
-	for _, row := range rows {
-		values := make([]interface{}, len(columns))
-		for i, col := range columns {
-			values[i] = row[col]
-		}
-
-		if _, err := tx.Exec(ctx, query, values...); err != nil {
-			return fmt.Errorf("failed to insert row: %w", err)
-		}
-	}
-
-	return nil
+	return query, nil
 }
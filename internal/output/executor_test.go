@@ -0,0 +1,72 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+	"github.com/riyasyash/pg_rocket/internal/extractor"
+	"github.com/riyasyash/pg_rocket/internal/graph"
+)
+
+func TestValidateForeignKeys(t *testing.T) {
+	managerFK := db.ForeignKey{
+		Name:          "users_manager_id_fkey",
+		ChildTable:    "public.users",
+		ChildColumns:  []string{"manager_id"},
+		ParentTable:   "public.managers",
+		ParentColumns: []string{"id"},
+	}
+	g := graph.NewGraph(&db.Metadata{
+		Parents:    map[string][]db.ForeignKey{"public.users": {managerFK}},
+		Children:   map[string][]db.ForeignKey{"public.managers": {managerFK}},
+		PrimaryKey: map[string][]string{"public.users": {"id"}, "public.managers": {"id"}},
+		Columns: map[string][]db.Column{
+			"public.users":    {{Name: "id", NotNull: true}, {Name: "manager_id"}},
+			"public.managers": {{Name: "id", NotNull: true}},
+		},
+	})
+
+	tests := []struct {
+		name     string
+		managers []interface{}
+		users    []interface{} // manager_id of each user
+		wantErr  bool
+	}{
+		{name: "NULL references without parent rows", users: []interface{}{nil, nil}},
+		{name: "references to extracted parents", managers: []interface{}{int64(1)}, users: []interface{}{int64(1), nil}},
+		{name: "reference without parent rows", users: []interface{}{nil, int64(1)}, wantErr: true},
+		{name: "reference to a parent not extracted", managers: []interface{}{int64(1)}, users: []interface{}{int64(2)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := extractor.NewTraversalState(g, nil, &extractor.TraversalOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer state.Close()
+
+			// Rows are stored under the text of their id, as traversal does
+			for _, id := range tt.managers {
+				if _, err := state.Rows.Add("public.managers", fmt.Sprint(id), map[string]interface{}{"id": id}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, managerID := range tt.users {
+				if _, err := state.Rows.Add("public.users", fmt.Sprint(i), map[string]interface{}{"id": int64(i), "manager_id": managerID}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = NewExecutor(nil, g, false, false).validateForeignKeys(state)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("validateForeignKeys() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "public.managers (1 rows via users_manager_id_fkey)") {
+				t.Errorf("validateForeignKeys() = %v, want the missing reference counted", err)
+			}
+		})
+	}
+}
@@ -25,57 +25,62 @@ func NewJSONWriter(writer io.Writer, g *graph.Graph) *JSONWriter {
 	}
 }
 
-// Write outputs the extracted data as JSON with tables sorted topologically
-// and rows sorted by primary key for deterministic output.
+// Write outputs the extracted data as a JSON object of row arrays keyed by
+// table name, in name order, with rows sorted by primary key (or row key for
+// tables without one) for deterministic output. Rows are streamed from the
+// state's store one at a time.
 func (w *JSONWriter) Write(ctx context.Context, state *extractor.TraversalState) error {
 	tables := state.GetAllTables()
-
-	sortedTables, err := w.graph.TopologicalSort(tables)
-	if err != nil {
-		return fmt.Errorf("failed to sort tables: %w", err)
-	}
+	sort.Strings(tables)
 
 	state.Progress.OutputGeneration("JSON")
 
-	result := make(map[string][]map[string]interface{})
+	// Written incrementally in the layout of json.MarshalIndent(result, "", "  ")
+	fmt.Fprint(w.writer, "{")
 
-	for i, tableName := range sortedTables {
-		rows := state.TableData[tableName]
-		if len(rows) == 0 {
-			result[tableName] = []map[string]interface{}{}
-			continue
-		}
+	for i, tableName := range tables {
+		count := state.Rows.Len(tableName)
+		state.Progress.WritingTable(tableName, count, i+1, len(tables))
 
-		state.Progress.WritingTable(tableName, len(rows), i+1, len(sortedTables))
+		name, err := json.Marshal(tableName)
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
 
-		pkColumns := w.graph.GetPrimaryKeyColumns(tableName)
+		if i > 0 {
+			fmt.Fprint(w.writer, ",")
+		}
+		fmt.Fprintf(w.writer, "\n  %s: ", name)
 
-		sortedRows := make([]map[string]interface{}, len(rows))
-		copy(sortedRows, rows)
+		if count == 0 {
+			fmt.Fprint(w.writer, "[]")
+			continue
+		}
 
-		// Sort by composite PK
-		sort.Slice(sortedRows, func(i, j int) bool {
-			for _, pkCol := range pkColumns {
-				vi := fmt.Sprintf("%v", sortedRows[i][pkCol])
-				vj := fmt.Sprintf("%v", sortedRows[j][pkCol])
-				if vi != vj {
-					return vi < vj
-				}
+		fmt.Fprint(w.writer, "[")
+		err = forEachRow(state, nil, tableName, func(j int, row map[string]interface{}) error {
+			encoded, err := json.MarshalIndent(row, "    ", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode JSON: %w", err)
+			}
+			if j > 0 {
+				fmt.Fprint(w.writer, ",")
 			}
-			return false
+			fmt.Fprintf(w.writer, "\n    %s", encoded)
+			return nil
 		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(w.writer, "\n  ]")
+	}
 
-		result[tableName] = sortedRows
+	if len(tables) > 0 {
+		fmt.Fprint(w.writer, "\n")
 	}
+	fmt.Fprintln(w.writer, "}")
 
 	state.Progress.FinishProgress()
 
-	encoder := json.NewEncoder(w.writer)
-	encoder.SetIndent("", "  ")
-
-	if err := encoder.Encode(result); err != nil {
-		return fmt.Errorf("failed to encode JSON: %w", err)
-	}
-
 	return nil
 }
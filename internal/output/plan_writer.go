@@ -0,0 +1,110 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/riyasyash/pg_rocket/internal/extractor"
+	"github.com/riyasyash/pg_rocket/internal/graph"
+)
+
+// PlanWriter renders an extraction plan produced by --dry-run.
+type PlanWriter struct {
+	writer io.Writer
+}
+
+// NewPlanWriter creates a new plan writer that outputs to the given writer.
+func NewPlanWriter(writer io.Writer) *PlanWriter {
+	return &PlanWriter{writer: writer}
+}
+
+// WriteJSON outputs the plan as an indented JSON document.
+func (w *PlanWriter) WriteJSON(plan *extractor.ExtractionPlan) error {
+	encoder := json.NewEncoder(w.writer)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(plan); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+
+	return nil
+}
+
+// WriteText outputs the plan in a human-readable form: the root queries, the
+// foreign keys followed in traversal order, and the tables in insert order
+// with their estimated row counts.
+func (w *PlanWriter) WriteText(plan *extractor.ExtractionPlan) error {
+	out := w.writer
+
+	fmt.Fprintln(out, "Extraction plan (dry run, no data fetched)")
+	fmt.Fprintln(out)
+	for _, root := range plan.Roots {
+		fmt.Fprintf(out, "Root: %s (~%d rows)\n", root.Table, root.EstimatedRows)
+		fmt.Fprintf(out, "  %s\n", root.Query)
+	}
+	for i, param := range plan.Params {
+		name := param.Name
+		if param.Type != "" {
+			name += ":" + param.Type
+		}
+		fmt.Fprintf(out, "  $%d %s = %v\n", i+1, name, param.Value)
+	}
+	if sample := plan.Options.Sample; sample != nil {
+		if sample.Rows > 0 {
+			fmt.Fprintf(out, "  Sample: %d rows per root query (seed %d)\n", sample.Rows, sample.Seed)
+		} else {
+			fmt.Fprintf(out, "  Sample: %g%% of each root query (seed %d)\n", sample.Fraction*100, sample.Seed)
+		}
+	}
+	fmt.Fprintln(out)
+
+	fmt.Fprintln(out, "Traversal:")
+	if len(plan.Steps) == 0 {
+		fmt.Fprintln(out, "  (no foreign keys followed)")
+	}
+	for i, step := range plan.Steps {
+		arrow, join := "↑", "→"
+		if step.Direction == graph.DirectionDown {
+			arrow, join = "↓", "←"
+		}
+
+		fmt.Fprintf(out, "  %3d. %-11s %s %s %s via %s (%s %s %s)",
+			i+1, fmt.Sprintf("[round %d]", step.Round), step.From, arrow, step.To, step.ForeignKey,
+			strings.Join(step.FromColumns, ", "), join, strings.Join(step.ToColumns, ", "))
+
+		if step.Skipped != "" {
+			fmt.Fprintf(out, "  skipped: %s\n", step.Skipped)
+		} else {
+			fmt.Fprintf(out, "  ~%d rows\n", step.EstimatedRows)
+		}
+	}
+	fmt.Fprintln(out)
+
+	fmt.Fprintln(out, "Insert order:")
+	for i, table := range plan.Tables {
+		total := "unknown"
+		if table.TableRows >= 0 {
+			total = fmt.Sprintf("%d", table.TableRows)
+		}
+		fmt.Fprintf(out, "  %3d. %s  ~%d of %s rows\n", i+1, table.Name, table.EstimatedRows, total)
+	}
+
+	if len(plan.Deferred) > 0 {
+		fmt.Fprintf(out, "\nDeferred to commit: %s\n", strings.Join(plan.Deferred, ", "))
+	}
+	if len(plan.Postponed) > 0 {
+		fmt.Fprintf(out, "\nSet by follow-up UPDATE: %s\n", strings.Join(plan.Postponed, ", "))
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Estimated total: ~%d rows in %d tables (--max-rows %d)\n",
+		plan.EstimatedRows, len(plan.Tables), plan.MaxRows)
+
+	if plan.EstimatedRows > int64(plan.MaxRows) {
+		fmt.Fprintln(out, "Warning: the estimate exceeds --max-rows; the extraction may need --force")
+	}
+
+	return nil
+}
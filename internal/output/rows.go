@@ -0,0 +1,67 @@
+package output
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/riyasyash/pg_rocket/internal/extractor"
+)
+
+// forEachRow calls fn with each row of tableName and its position in output
+// order: the order of the store positions in prepared for tables reordered by
+// prepareRows, read back in batches, otherwise row key order, streamed from
+// the store.
+func forEachRow(state *extractor.TraversalState, prepared map[string][]int, tableName string, fn func(i int, row map[string]interface{}) error) error {
+	if positions, ok := prepared[tableName]; ok {
+		for start := 0; start < len(positions); start += extractor.BatchSize {
+			rows, err := state.Rows.Rows(tableName, positions[start:min(start+extractor.BatchSize, len(positions))])
+			if err != nil {
+				return err
+			}
+			for i, row := range rows {
+				if err := fn(start+i, row); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	it, err := state.Rows.Sorted(tableName)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for i := 0; it.Next(); i++ {
+		if err := fn(i, it.Row()); err != nil {
+			return err
+		}
+	}
+
+	return it.Err()
+}
+
+// sortedColumns returns the column names of a row in alphabetical order.
+func sortedColumns(row map[string]interface{}) []string {
+	columns := make([]string, 0, len(row))
+	for col := range row {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// tupleKey returns a comparable key for the values of the given columns in row.
+// It reports false if any of the values is NULL, in which case the row does
+// not reference anything (MATCH SIMPLE semantics).
+func tupleKey(row map[string]interface{}, columns []string) (string, bool) {
+	values := make([]interface{}, len(columns))
+	for i, col := range columns {
+		if row[col] == nil {
+			return "", false
+		}
+		values[i] = row[col]
+	}
+	return fmt.Sprintf("%v", values), true
+}
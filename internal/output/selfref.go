@@ -0,0 +1,225 @@
+package output
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+	"github.com/riyasyash/pg_rocket/internal/extractor"
+	"github.com/riyasyash/pg_rocket/internal/graph"
+	"github.com/riyasyash/pg_rocket/internal/storage"
+)
+
+// prepareRows reorders the rows of self-referencing tables so that each
+// referenced row is inserted before the rows that point to it (e.g. parent
+// categories before their subcategories), starting from row key order. It
+// returns the store positions of their rows in insert order, by table; rows
+// of other tables are streamed in row key order (see forEachRow).
+// Self-referential FKs whose rows reference each other in a cycle are added to
+// the plan: deferred if DEFERRABLE, otherwise postponed to a NULL-then-UPDATE
+// pass.
+func prepareRows(g *graph.Graph, state *extractor.TraversalState, plan *graph.InsertPlan) (map[string][]int, error) {
+	prepared := make(map[string][]int)
+
+	for _, tableName := range plan.Order {
+		if state.Rows.Len(tableName) == 0 {
+			continue
+		}
+
+		selfFKs := make([]db.ForeignKey, 0)
+		for _, fk := range g.Parents[tableName] {
+			// Virtual FKs are not enforced, so their rows can go in any order
+			if fk.ParentTable == tableName && !fk.Virtual {
+				selfFKs = append(selfFKs, fk)
+			}
+		}
+		if len(selfFKs) == 0 {
+			continue
+		}
+
+		// Ordering needs every row of the table, so only the columns it
+		// compares are held in memory
+		keyColumns := g.GetRowKeyColumns(tableName)
+		positions, keys, err := readKeys(state, tableName, keyColumns, selfFKs)
+		if err != nil {
+			return nil, err
+		}
+
+		order, cyclic := orderSelfReferencing(keys, selfFKs)
+		prepared[tableName] = make([]int, len(order))
+		for i, index := range order {
+			prepared[tableName][i] = positions[index]
+		}
+
+		for _, fk := range cyclic {
+			switch {
+			case fk.Deferrable:
+				plan.Deferred = append(plan.Deferred, fk)
+			case g.IsNullable(tableName, fk.ChildColumns):
+				plan.Postponed = append(plan.Postponed, fk)
+			default:
+				return nil, fmt.Errorf("rows of %s reference each other in a cycle through %s, which is NOT NULL and not DEFERRABLE", tableName, fk.Name)
+			}
+		}
+	}
+
+	return prepared, nil
+}
+
+// readKeys reads the rows of tableName keeping the values of keyColumns and
+// of the columns of selfFKs, and returns them in row key order (see
+// storage.Less) with the store position of each. Rows of a table without a
+// key are kept whole, as they are ordered by all of their columns.
+func readKeys(state *extractor.TraversalState, tableName string, keyColumns []string, selfFKs []db.ForeignKey) ([]int, []map[string]interface{}, error) {
+	columns := append([]string{}, keyColumns...)
+	for _, fk := range selfFKs {
+		columns = append(columns, fk.ParentColumns...)
+		columns = append(columns, fk.ChildColumns...)
+	}
+
+	count := state.Rows.Len(tableName)
+	keys := make([]map[string]interface{}, 0, count)
+	for start := 0; start < count; start += extractor.BatchSize {
+		indices := make([]int, 0, extractor.BatchSize)
+		for i := start; i < min(start+extractor.BatchSize, count); i++ {
+			indices = append(indices, i)
+		}
+
+		rows, err := state.Rows.Rows(tableName, indices)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, row := range rows {
+			if len(keyColumns) == 0 {
+				keys = append(keys, row)
+				continue
+			}
+
+			key := make(map[string]interface{}, len(columns))
+			for _, col := range columns {
+				key[col] = row[col]
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	positions := make([]int, count)
+	for i := range positions {
+		positions[i] = i
+	}
+	sort.SliceStable(positions, func(i, j int) bool {
+		return storage.Less(keys[positions[i]], keys[positions[j]], keyColumns)
+	})
+
+	sorted := make([]map[string]interface{}, count)
+	for i, position := range positions {
+		sorted[i] = keys[position]
+	}
+
+	return positions, sorted, nil
+}
+
+// orderSelfReferencing returns the indexes of rows ordered so that rows
+// referenced through the given self-referential FKs come first, keeping the
+// existing order among rows that do not depend on each other. Rows that
+// reference each other in a cycle are appended at the end in their existing
+// order, and the FKs involved are returned so the caller can break the cycle.
+func orderSelfReferencing(rows []map[string]interface{}, selfFKs []db.ForeignKey) ([]int, []db.ForeignKey) {
+	dependents := make([][]int, len(rows))
+	inDegree := make([]int, len(rows))
+	edgeFK := make(map[[2]int]int) // (parent, child) row index -> index into selfFKs
+
+	for f, fk := range selfFKs {
+		byKey := make(map[string]int)
+		for i, row := range rows {
+			if key, ok := tupleKey(row, fk.ParentColumns); ok {
+				byKey[key] = i
+			}
+		}
+
+		for i, row := range rows {
+			key, ok := tupleKey(row, fk.ChildColumns)
+			if !ok {
+				continue
+			}
+			parent, found := byKey[key]
+			// A row referencing itself is checked after it is inserted, so it needs no ordering
+			if !found || parent == i {
+				continue
+			}
+			if _, exists := edgeFK[[2]int{parent, i}]; exists {
+				continue
+			}
+			edgeFK[[2]int{parent, i}] = f
+			dependents[parent] = append(dependents[parent], i)
+			inDegree[i]++
+		}
+	}
+
+	ready := &indexHeap{}
+	for i := range rows {
+		if inDegree[i] == 0 {
+			heap.Push(ready, i)
+		}
+	}
+
+	ordered := make([]int, 0, len(rows))
+	placed := make([]bool, len(rows))
+
+	for ready.Len() > 0 {
+		current := heap.Pop(ready).(int)
+		ordered = append(ordered, current)
+		placed[current] = true
+
+		for _, child := range dependents[current] {
+			inDegree[child]--
+			if inDegree[child] == 0 {
+				heap.Push(ready, child)
+			}
+		}
+	}
+
+	if len(ordered) == len(rows) {
+		return ordered, nil
+	}
+
+	// Remaining rows are in (or depend on) a cycle among rows
+	cyclicFKs := make(map[int]bool)
+	for edge, f := range edgeFK {
+		if !placed[edge[0]] && !placed[edge[1]] {
+			cyclicFKs[f] = true
+		}
+	}
+	for i := range rows {
+		if !placed[i] {
+			ordered = append(ordered, i)
+		}
+	}
+
+	cyclic := make([]db.ForeignKey, 0, len(cyclicFKs))
+	for f, fk := range selfFKs {
+		if cyclicFKs[f] {
+			cyclic = append(cyclic, fk)
+		}
+	}
+
+	return ordered, cyclic
+}
+
+// indexHeap is a min-heap of row indexes, used to keep the original row
+// order among rows that are ready to be inserted.
+type indexHeap []int
+
+func (h indexHeap) Len() int            { return len(h) }
+func (h indexHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h indexHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *indexHeap) Push(x interface{}) { *h = append(*h, x.(int)) }
+func (h *indexHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
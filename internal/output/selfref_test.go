@@ -0,0 +1,162 @@
+package output
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/riyasyash/pg_rocket/internal/db"
+	"github.com/riyasyash/pg_rocket/internal/extractor"
+	"github.com/riyasyash/pg_rocket/internal/graph"
+)
+
+var parentFK = db.ForeignKey{
+	Name:          "categories_parent_id_fkey",
+	ChildTable:    "public.categories",
+	ChildColumns:  []string{"parent_id"},
+	ParentTable:   "public.categories",
+	ParentColumns: []string{"id"},
+}
+
+// categories returns rows of id and parent_id pairs, a nil parent_id for
+// top-level categories.
+func categories(pairs ...interface{}) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		rows = append(rows, map[string]interface{}{"id": pairs[i], "parent_id": pairs[i+1]})
+	}
+	return rows
+}
+
+func TestOrderSelfReferencingParentsFirst(t *testing.T) {
+	rows := categories(1, 3, 2, nil, 3, 2, 4, 1, 5, 5)
+
+	order, cyclic := orderSelfReferencing(rows, []db.ForeignKey{parentFK})
+
+	// 2 <- 3 <- 1 <- 4; 5 references itself and keeps its place
+	if want := []int{1, 2, 0, 3, 4}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	if len(cyclic) != 0 {
+		t.Errorf("cyclic = %v, want none", fkNames(cyclic))
+	}
+}
+
+func TestOrderSelfReferencingCycle(t *testing.T) {
+	rows := categories(1, 2, 2, 1, 3, nil, 4, 3)
+
+	order, cyclic := orderSelfReferencing(rows, []db.ForeignKey{parentFK})
+
+	// Rows outside the cycle come first; the cycle keeps its order at the end
+	if want := []int{2, 3, 0, 1}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	if want := []string{parentFK.Name}; !reflect.DeepEqual(fkNames(cyclic), want) {
+		t.Errorf("cyclic = %v, want %v", fkNames(cyclic), want)
+	}
+}
+
+func TestPrepareRows(t *testing.T) {
+	tests := []struct {
+		name         string
+		notNull      bool
+		deferrable   bool
+		rows         []map[string]interface{}
+		want         []int // Store positions in insert order
+		wantDeferred []string
+		wantPostpone []string
+		wantErr      bool
+	}{
+		{
+			name: "parents first from key order",
+			rows: categories(3, 2, 1, nil, 2, 1),
+			want: []int{1, 2, 0},
+		},
+		{
+			name:         "cycle postponed through a nullable column",
+			rows:         categories(2, 1, 1, 2),
+			want:         []int{1, 0},
+			wantPostpone: []string{parentFK.Name},
+		},
+		{
+			name:         "cycle deferred through a deferrable constraint",
+			notNull:      true,
+			deferrable:   true,
+			rows:         categories(2, 1, 1, 2),
+			want:         []int{1, 0},
+			wantDeferred: []string{parentFK.Name},
+		},
+		{
+			name:    "unbreakable cycle",
+			notNull: true,
+			rows:    categories(2, 1, 1, 2),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fk := parentFK
+			fk.Deferrable = tt.deferrable
+			g := graph.NewGraph(&db.Metadata{
+				Parents:    map[string][]db.ForeignKey{"public.categories": {fk}},
+				Children:   map[string][]db.ForeignKey{"public.categories": {fk}},
+				PrimaryKey: map[string][]string{"public.categories": {"id"}},
+				Columns: map[string][]db.Column{"public.categories": {
+					{Name: "id", NotNull: true},
+					{Name: "parent_id", NotNull: tt.notNull},
+				}},
+			})
+
+			state, err := extractor.NewTraversalState(g, nil, &extractor.TraversalOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer state.Close()
+
+			for _, row := range tt.rows {
+				if _, err := state.Rows.Add("public.categories", fmt.Sprint(row["id"]), row); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			plan := &graph.InsertPlan{Order: []string{"public.categories"}}
+			prepared, err := prepareRows(g, state, plan)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "NOT NULL and not DEFERRABLE") {
+					t.Fatalf("prepareRows error = %v, want an unbreakable cycle error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := prepared["public.categories"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("positions = %v, want %v", got, tt.want)
+			}
+			if got := fkNames(plan.Deferred); !reflect.DeepEqual(got, nonNil(tt.wantDeferred)) {
+				t.Errorf("Deferred = %v, want %v", got, tt.wantDeferred)
+			}
+			if got := fkNames(plan.Postponed); !reflect.DeepEqual(got, nonNil(tt.wantPostpone)) {
+				t.Errorf("Postponed = %v, want %v", got, tt.wantPostpone)
+			}
+		})
+	}
+}
+
+func fkNames(fks []db.ForeignKey) []string {
+	names := make([]string, len(fks))
+	for i, fk := range fks {
+		names[i] = fk.Name
+	}
+	return names
+}
+
+func nonNil(names []string) []string {
+	if names == nil {
+		return []string{}
+	}
+	return names
+}
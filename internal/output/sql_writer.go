@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/riyasyash/pg_rocket/internal/db"
 	"github.com/riyasyash/pg_rocket/internal/extractor"
 	"github.com/riyasyash/pg_rocket/internal/graph"
 )
@@ -29,82 +30,141 @@ func NewSQLWriter(writer io.Writer, g *graph.Graph) *SQLWriter {
 	}
 }
 
+// Write outputs INSERT statements for all extracted tables in topological order.
+// Foreign key cycles are broken the same way as by Executor: DEFERRABLE
+// constraints are deferred inside an explicit transaction, and other cycle FKs
+// are inserted as NULL and restored by UPDATE statements at the end.
 func (w *SQLWriter) Write(ctx context.Context, state *extractor.TraversalState) error {
 	tables := state.GetAllTables()
 
-	sortedTables, err := w.graph.TopologicalSort(tables)
+	plan, err := w.graph.PlanInserts(tables)
 	if err != nil {
 		return fmt.Errorf("failed to sort tables: %w", err)
 	}
 
+	prepared, err := prepareRows(w.graph, state, plan)
+	if err != nil {
+		return err
+	}
+	sortedTables := plan.Order
+
 	state.Progress.OutputGeneration("SQL")
 
 	fmt.Fprintln(w.writer, "-- pg_rocket data export")
 	fmt.Fprintf(w.writer, "-- Generated at: %s\n", time.Now().Format(time.RFC3339))
 	fmt.Fprintln(w.writer, "-- Total tables:", len(sortedTables))
+	if assumed := state.AssumedPresent(); len(assumed) > 0 {
+		fmt.Fprintln(w.writer, "-- Excluded parents assumed present in the target:")
+		for _, fk := range assumed {
+			fmt.Fprintf(w.writer, "--   %s (%s) -> %s via %s\n",
+				fk.ChildTable, strings.Join(fk.ChildColumns, ", "), fk.ParentTable, fk.Name)
+		}
+	}
 	fmt.Fprintln(w.writer)
 
+	// SET CONSTRAINTS only lasts until the end of the current transaction
+	if len(plan.Deferred) > 0 {
+		fmt.Fprintln(w.writer, "BEGIN;")
+		fmt.Fprintln(w.writer, "SET CONSTRAINTS ALL DEFERRED;")
+		fmt.Fprintln(w.writer)
+	}
+
+	nullColumns := postponedColumns(plan)
+
 	for i, tableName := range sortedTables {
-		rows := state.TableData[tableName]
-		if len(rows) == 0 {
+		count := state.Rows.Len(tableName)
+		if count == 0 {
 			continue
 		}
 
-		state.Progress.WritingTable(tableName, len(rows), i+1, len(sortedTables))
+		state.Progress.WritingTable(tableName, count, i+1, len(sortedTables))
 
-		if err := w.writeTable(tableName, rows); err != nil {
+		if err := w.writeTable(state, prepared, tableName, nullColumns[tableName]); err != nil {
 			return err
 		}
 	}
 
-	state.Progress.FinishProgress()
-	return nil
-}
+	if err := w.writePostponed(state, prepared, plan, nullColumns); err != nil {
+		return err
+	}
 
-func (w *SQLWriter) writeTable(tableName string, rows []map[string]interface{}) error {
-	if len(rows) == 0 {
-		return nil
+	if len(plan.Deferred) > 0 {
+		fmt.Fprintln(w.writer, "COMMIT;")
 	}
 
-	pkColumns := w.graph.GetPrimaryKeyColumns(tableName)
+	state.Progress.FinishProgress()
+	return nil
+}
 
-	// Sort by composite PK
-	sort.Slice(rows, func(i, j int) bool {
-		for _, pkCol := range pkColumns {
-			vi := fmt.Sprintf("%v", rows[i][pkCol])
-			vj := fmt.Sprintf("%v", rows[j][pkCol])
-			if vi != vj {
-				return vi < vj
+// writePostponed emits the UPDATE statements that restore FK columns inserted
+// as NULL to break cycles.
+func (w *SQLWriter) writePostponed(state *extractor.TraversalState, prepared map[string][]int, plan *graph.InsertPlan, nullColumns map[string]map[string]bool) error {
+	for _, fk := range plan.Postponed {
+		statements := make([]string, 0)
+		err := forEachRow(state, prepared, fk.ChildTable, func(_ int, row map[string]interface{}) error {
+			if stmt, ok := postponedUpdate(w.graph, fk, row, nullColumns[fk.ChildTable], formatValue); ok {
+				statements = append(statements, stmt)
 			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
-		return false
-	})
 
-	columns := make([]string, 0)
-	if len(rows) > 0 {
-		for col := range rows[0] {
-			columns = append(columns, col)
+		if len(statements) == 0 {
+			continue
 		}
-		sort.Strings(columns)
+
+		fmt.Fprintf(w.writer, "-- Restore %s (postponed to break a foreign key cycle)\n", fk.Name)
+		for _, stmt := range statements {
+			fmt.Fprintf(w.writer, "%s;\n", stmt)
+		}
+		fmt.Fprintln(w.writer)
 	}
 
-	fmt.Fprintf(w.writer, "-- Table: %s (%d rows)\n", tableName, len(rows))
-	fmt.Fprintf(w.writer, "INSERT INTO %s (%s)\nVALUES\n",
-		tableName, strings.Join(columns, ", "))
+	return nil
+}
+
+// writeTable writes a multi-row INSERT for tableName, streaming its rows in
+// output order (see forEachRow). Columns in nullColumns are written as NULL;
+// they belong to foreign keys postponed to break a cycle.
+func (w *SQLWriter) writeTable(state *extractor.TraversalState, prepared map[string][]int, tableName string, nullColumns map[string]bool) error {
+	count := state.Rows.Len(tableName)
+	if count == 0 {
+		return nil
+	}
+
+	var columns []string
+
+	err := forEachRow(state, prepared, tableName, func(i int, row map[string]interface{}) error {
+		if i == 0 {
+			columns = sortedColumns(row)
+
+			fmt.Fprintf(w.writer, "-- Table: %s (%d rows)\n", tableName, count)
+			fmt.Fprintf(w.writer, "INSERT INTO %s (%s)\nVALUES\n",
+				db.QuoteTable(tableName), strings.Join(columns, ", "))
+		}
 
-	for i, row := range rows {
 		values := make([]string, len(columns))
 		for j, col := range columns {
-			values[j] = formatValue(row[col])
+			if nullColumns[col] {
+				values[j] = "NULL"
+			} else {
+				values[j] = formatValue(row[col])
+			}
 		}
 
 		fmt.Fprintf(w.writer, "  (%s)", strings.Join(values, ", "))
 
-		if i < len(rows)-1 {
+		if i < count-1 {
 			fmt.Fprintln(w.writer, ",")
 		} else {
 			fmt.Fprintln(w.writer, ";")
 		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", tableName, err)
 	}
 
 	fmt.Fprintln(w.writer)
@@ -0,0 +1,467 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// DefaultSegmentRows is the number of rows per table that DiskStore buffers in
+// memory before writing them to a segment file.
+const DefaultSegmentRows = 10000
+
+// rowsPerBlock is the number of rows per block of a segment's position file,
+// the unit in which Rows reads written rows.
+const rowsPerBlock = 256
+
+func init() {
+	// Values are stored as interface{}; gob must know every concrete type
+	// pgx decodes to besides the basic ones it registers itself
+	gob.Register(time.Time{})
+	gob.Register([16]uint8{}) // uuid
+	gob.Register([]interface{}{})
+	gob.Register(map[string]interface{}{})
+	gob.Register(map[string]*string{}) // hstore
+	gob.Register(net.HardwareAddr{})
+	gob.Register(netip.Prefix{})
+	gob.Register(pgtype.Numeric{})
+	gob.Register(pgtype.Interval{})
+	gob.Register(pgtype.Time{})
+}
+
+// DiskStore keeps at most segmentRows rows per table in memory. Full buffers
+// are written to a segment: once sorted by row key, so that Sorted only has to
+// merge the segments, and once by position in independently decodable blocks,
+// so that Rows only decodes the blocks holding the rows it returns. Keys are
+// kept in an on-disk index (see keyIndex). Files live in a private directory
+// removed by Close.
+type DiskStore struct {
+	dir         string
+	keyColumns  KeyColumns
+	segmentRows int
+	tables      map[string]*diskTable
+	files       int // Files created so far, used to name new ones
+}
+
+// diskTable is the state of one table in a DiskStore.
+type diskTable struct {
+	name     string
+	buffer   []storedRow // Rows not written yet, by position
+	segments []segment   // Written rows, by position of their first row
+	length   int
+	keys     *keyIndex
+}
+
+// storedRow is a row with its position in the table, as written to segments.
+type storedRow struct {
+	Index int
+	Row   map[string]interface{}
+}
+
+// segment holds the rows from position first to first+count-1.
+type segment struct {
+	path    string  // Rows sorted by row key
+	blocks  string  // Rows by position, in blocks of rowsPerBlock
+	offsets []int64 // Start of each block in blocks, then the file size
+	first   int
+	count   int
+}
+
+// NewDiskStore creates an empty disk-backed store in a new directory under
+// parent (the system temporary directory if empty). Sorted orders rows by
+// keyColumns. segmentRows values below 1 mean DefaultSegmentRows.
+func NewDiskStore(parent string, keyColumns KeyColumns, segmentRows int) (*DiskStore, error) {
+	if segmentRows < 1 {
+		segmentRows = DefaultSegmentRows
+	}
+
+	dir, err := os.MkdirTemp(parent, "pg_rocket-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+
+	return &DiskStore{
+		dir:         dir,
+		keyColumns:  keyColumns,
+		segmentRows: segmentRows,
+		tables:      make(map[string]*diskTable),
+	}, nil
+}
+
+// newPath returns the path of a new file in the store's directory.
+func (s *DiskStore) newPath(kind string) string {
+	s.files++
+	return filepath.Join(s.dir, fmt.Sprintf("%s-%d", kind, s.files))
+}
+
+func (s *DiskStore) table(name string) *diskTable {
+	t, ok := s.tables[name]
+	if !ok {
+		t = &diskTable{name: name, keys: newKeyIndex(s.newPath("index"), s.segmentRows)}
+		s.tables[name] = t
+	}
+	return t
+}
+
+func (s *DiskStore) Lookup(table, key string) (int, bool, error) {
+	t, ok := s.tables[table]
+	if !ok {
+		return 0, false, nil
+	}
+	return t.keys.lookup(key)
+}
+
+func (s *DiskStore) Add(table, key string, row map[string]interface{}) (int, error) {
+	t := s.table(table)
+
+	index := t.length
+	if err := t.keys.add(key, index); err != nil {
+		return 0, fmt.Errorf("failed to index row of %s: %w", table, err)
+	}
+
+	t.buffer = append(t.buffer, storedRow{Index: index, Row: row})
+	t.length++
+
+	if len(t.buffer) >= s.segmentRows {
+		if err := s.flush(t); err != nil {
+			return 0, err
+		}
+	}
+
+	return index, nil
+}
+
+// flush writes the buffered rows of t to a new segment, sorted by row key.
+func (s *DiskStore) flush(t *diskTable) error {
+	records := s.sortedBuffer(t)
+	path := s.newPath("segment")
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write rows of %s: %w", t.name, err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := gob.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to write rows of %s: %w", t.name, err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write rows of %s: %w", t.name, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write rows of %s: %w", t.name, err)
+	}
+
+	blocks := s.newPath("blocks")
+	offsets, err := writeBlocks(blocks, t.buffer)
+	if err != nil {
+		return fmt.Errorf("failed to write rows of %s: %w", t.name, err)
+	}
+
+	t.segments = append(t.segments, segment{
+		path:    path,
+		blocks:  blocks,
+		offsets: offsets,
+		first:   t.buffer[0].Index,
+		count:   len(t.buffer),
+	})
+	t.buffer = nil
+	return nil
+}
+
+// writeBlocks writes the rows of records, in position order, to a file of
+// blocks of rowsPerBlock rows and returns the offsets of the blocks. Each
+// block is encoded on its own, so that it can be decoded without the others.
+func writeBlocks(path string, records []storedRow) ([]int64, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var block bytes.Buffer
+	offsets := []int64{0}
+	for start := 0; start < len(records); start += rowsPerBlock {
+		rows := make([]map[string]interface{}, 0, rowsPerBlock)
+		for _, record := range records[start:min(start+rowsPerBlock, len(records))] {
+			rows = append(rows, record.Row)
+		}
+
+		block.Reset()
+		if err := gob.NewEncoder(&block).Encode(rows); err != nil {
+			return nil, err
+		}
+		if _, err := file.Write(block.Bytes()); err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, offsets[len(offsets)-1]+int64(block.Len()))
+	}
+
+	return offsets, file.Close()
+}
+
+// sortedBuffer returns the buffered rows of t sorted by row key and position.
+func (s *DiskStore) sortedBuffer(t *diskTable) []storedRow {
+	records := make([]storedRow, len(t.buffer))
+	copy(records, t.buffer)
+
+	keyColumns := s.keyColumns(t.name)
+	sort.SliceStable(records, func(i, j int) bool {
+		return Less(records[i].Row, records[j].Row, keyColumns)
+	})
+	return records
+}
+
+func (s *DiskStore) Len(table string) int {
+	if t, ok := s.tables[table]; ok {
+		return t.length
+	}
+	return 0
+}
+
+func (s *DiskStore) Tables() []string {
+	tables := make([]string, 0, len(s.tables))
+	for table, t := range s.tables {
+		if t.length > 0 {
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Rows decodes each block holding one of the requested rows once, in file
+// order, so that the cost of a call is proportional to the rows it returns.
+func (s *DiskStore) Rows(table string, indices []int) ([]map[string]interface{}, error) {
+	t := s.table(table)
+	rows := make([]map[string]interface{}, len(indices))
+
+	buffered := t.length - len(t.buffer)
+	needed := make(map[blockRef][]int) // Block -> positions in indices
+
+	for i, index := range indices {
+		switch {
+		case index < 0 || index >= t.length:
+			return nil, fmt.Errorf("row %d of %s does not exist", index, table)
+		case index >= buffered:
+			rows[i] = t.buffer[index-buffered].Row
+		default:
+			seg := sort.Search(len(t.segments), func(j int) bool {
+				return t.segments[j].first+t.segments[j].count > index
+			})
+			ref := blockRef{segment: seg, block: (index - t.segments[seg].first) / rowsPerBlock}
+			needed[ref] = append(needed[ref], i)
+		}
+	}
+
+	refs := make([]blockRef, 0, len(needed))
+	for ref := range needed {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].segment != refs[j].segment {
+			return refs[i].segment < refs[j].segment
+		}
+		return refs[i].block < refs[j].block
+	})
+
+	var file *os.File
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	for i, ref := range refs {
+		seg := t.segments[ref.segment]
+		if i == 0 || ref.segment != refs[i-1].segment {
+			if file != nil {
+				file.Close()
+			}
+			var err error
+			if file, err = os.Open(seg.blocks); err != nil {
+				return nil, fmt.Errorf("failed to read rows of %s: %w", table, err)
+			}
+		}
+
+		block, err := readBlock(file, seg.offsets[ref.block], seg.offsets[ref.block+1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rows of %s: %w", table, err)
+		}
+
+		blockFirst := seg.first + ref.block*rowsPerBlock
+		for _, pos := range needed[ref] {
+			rows[pos] = block[indices[pos]-blockFirst]
+		}
+	}
+
+	return rows, nil
+}
+
+// blockRef identifies a block of a table's segment.
+type blockRef struct {
+	segment int
+	block   int
+}
+
+// readBlock decodes the block of rows stored between offsets start and end of
+// a segment's blocks file.
+func readBlock(file *os.File, start, end int64) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	decoder := gob.NewDecoder(bufio.NewReader(io.NewSectionReader(file, start, end-start)))
+	if err := decoder.Decode(&rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Sorted merges the sorted segments of the table and its sorted buffer.
+func (s *DiskStore) Sorted(table string) (RowIterator, error) {
+	t := s.table(table)
+	it := &mergeIterator{keyColumns: s.keyColumns(table)}
+
+	runs := make([]*run, 0, len(t.segments)+1)
+	for _, seg := range t.segments {
+		file, err := os.Open(seg.path)
+		if err != nil {
+			it.Close()
+			return nil, fmt.Errorf("failed to read rows of %s: %w", table, err)
+		}
+		r := &run{file: file, decoder: gob.NewDecoder(bufio.NewReader(file))}
+		runs = append(runs, r)
+		it.files = append(it.files, file)
+	}
+	runs = append(runs, &run{records: s.sortedBuffer(t)})
+
+	for _, r := range runs {
+		ok, err := r.advance()
+		if err != nil {
+			it.Close()
+			return nil, fmt.Errorf("failed to read rows of %s: %w", table, err)
+		}
+		if ok {
+			it.runs = append(it.runs, r)
+		}
+	}
+	heap.Init(it)
+
+	return it, nil
+}
+
+func (s *DiskStore) Close() error {
+	for _, t := range s.tables {
+		t.keys.close()
+	}
+	s.tables = nil
+	return os.RemoveAll(s.dir)
+}
+
+// run is a sequence of rows sorted by row key: a segment file being read, or
+// rows in memory.
+type run struct {
+	records []storedRow
+	file    *os.File
+	decoder *gob.Decoder
+	head    storedRow
+}
+
+// advance moves head to the next row of the run, reporting false at the end.
+func (r *run) advance() (bool, error) {
+	if r.decoder == nil {
+		if len(r.records) == 0 {
+			return false, nil
+		}
+		r.head, r.records = r.records[0], r.records[1:]
+		return true, nil
+	}
+
+	r.head = storedRow{}
+	if err := r.decoder.Decode(&r.head); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// mergeIterator streams the rows of several runs in row key order, using a
+// min-heap of the runs ordered by their head rows.
+type mergeIterator struct {
+	keyColumns []string
+	runs       []*run
+	files      []*os.File
+	current    map[string]interface{}
+	err        error
+}
+
+func (it *mergeIterator) Len() int { return len(it.runs) }
+func (it *mergeIterator) Less(i, j int) bool {
+	a, b := it.runs[i].head, it.runs[j].head
+	if Less(a.Row, b.Row, it.keyColumns) {
+		return true
+	}
+	if Less(b.Row, a.Row, it.keyColumns) {
+		return false
+	}
+	return a.Index < b.Index
+}
+func (it *mergeIterator) Swap(i, j int)      { it.runs[i], it.runs[j] = it.runs[j], it.runs[i] }
+func (it *mergeIterator) Push(x interface{}) { it.runs = append(it.runs, x.(*run)) }
+func (it *mergeIterator) Pop() interface{} {
+	old := it.runs
+	n := len(old)
+	x := old[n-1]
+	it.runs = old[:n-1]
+	return x
+}
+
+func (it *mergeIterator) Next() bool {
+	if it.err != nil || len(it.runs) == 0 {
+		return false
+	}
+
+	top := it.runs[0]
+	it.current = top.head.Row
+
+	ok, err := top.advance()
+	if err != nil {
+		it.err = fmt.Errorf("failed to read rows: %w", err)
+		return false
+	}
+	if ok {
+		heap.Fix(it, 0)
+	} else {
+		heap.Pop(it)
+	}
+
+	return true
+}
+
+func (it *mergeIterator) Row() map[string]interface{} { return it.current }
+func (it *mergeIterator) Err() error                  { return it.err }
+
+func (it *mergeIterator) Close() error {
+	for _, file := range it.files {
+		file.Close()
+	}
+	it.files = nil
+	it.runs = nil
+	return nil
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func idKey(string) []string { return []string{"id"} }
+
+func newTestDiskStore(t *testing.T, segmentRows int) *DiskStore {
+	t.Helper()
+	store, err := NewDiskStore(t.TempDir(), idKey, segmentRows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func addRows(t *testing.T, store Store, table string, ids ...int) {
+	t.Helper()
+	for _, id := range ids {
+		row := map[string]interface{}{"id": fmt.Sprintf("%03d", id), "n": int64(id)}
+		if _, err := store.Add(table, fmt.Sprint(id), row); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDiskStoreRoundTripsValueTypes(t *testing.T) {
+	mac, _ := net.ParseMAC("08:00:2b:01:02:03")
+	text := "v"
+
+	values := map[string]interface{}{
+		"nil":       nil,
+		"bool":      true,
+		"int16":     int16(-2),
+		"int32":     int32(3),
+		"int64":     int64(1) << 40,
+		"float32":   float32(1.5),
+		"float64":   2.25,
+		"string":    "text",
+		"bytes":     []byte{0, 1, 2},
+		"time":      time.Date(2024, 1, 31, 12, 30, 0, 0, time.UTC),
+		"uuid":      [16]uint8{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		"array":     []interface{}{int32(1), "two", nil},
+		"json":      map[string]interface{}{"a": 1.0, "b": []interface{}{"c"}},
+		"hstore":    map[string]*string{"k": &text},
+		"macaddr":   mac,
+		"inet":      netip.MustParsePrefix("10.0.0.0/8"),
+		"numeric":   pgtype.Numeric{Int: big.NewInt(12345), Exp: -2, Valid: true},
+		"interval":  pgtype.Interval{Months: 1, Days: 2, Microseconds: 3, Valid: true},
+		"timeofday": pgtype.Time{Microseconds: 3600 * 1e6, Valid: true},
+	}
+
+	// One row per segment, so that every value is written and read back
+	store := newTestDiskStore(t, 1)
+	for name, value := range values {
+		if _, err := store.Add("t", name, map[string]interface{}{"id": name, "v": value}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	indices := make([]int, store.Len("t"))
+	for i := range indices {
+		indices[i] = i
+	}
+	rows, err := store.Rows("t", indices)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range rows {
+		name := row["id"].(string)
+		got, want := row["v"], values[name]
+		if wantTime, ok := want.(time.Time); ok {
+			if gotTime, ok := got.(time.Time); !ok || !gotTime.Equal(wantTime) {
+				t.Errorf("%s: got %#v, want %#v", name, got, want)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %#v, want %#v", name, got, want)
+		}
+	}
+}
+
+func TestDiskStoreDeduplicatesAcrossSpill(t *testing.T) {
+	store := newTestDiskStore(t, 4)
+	addRows(t, store, "t", 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+
+	for id := 1; id <= 10; id++ {
+		index, ok, err := store.Lookup("t", fmt.Sprint(id))
+		if err != nil || !ok || index != id-1 {
+			t.Errorf("Lookup(%d) = %d, %v, %v; want %d, true, nil", id, index, ok, err, id-1)
+		}
+	}
+
+	if _, ok, err := store.Lookup("t", "11"); ok || err != nil {
+		t.Errorf("Lookup(11) = %v, %v; want false, nil", ok, err)
+	}
+	if _, ok, _ := store.Lookup("other", "1"); ok {
+		t.Errorf("Lookup found a key of another table")
+	}
+}
+
+func TestDiskStoreSortedMergesSegmentsAndBuffer(t *testing.T) {
+	store := newTestDiskStore(t, 3)
+	// Two full segments and two buffered rows, each out of order
+	addRows(t, store, "t", 7, 2, 5, 8, 1, 4, 6, 3)
+
+	it, err := store.Sorted("t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	got := make([]int64, 0)
+	for it.Next() {
+		got = append(got, it.Row()["n"].(int64))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Sorted = %v, want %v", got, want)
+	}
+}
+
+func TestDiskStoreRows(t *testing.T) {
+	// Several blocks per segment, and a partial buffer
+	store := newTestDiskStore(t, 2*rowsPerBlock+10)
+	ids := make([]int, 3*rowsPerBlock)
+	for i := range ids {
+		ids[i] = len(ids) - i
+	}
+	addRows(t, store, "t", ids...)
+
+	indices := []int{len(ids) - 1, 0, rowsPerBlock, 2*rowsPerBlock + 10, rowsPerBlock + 1, 0}
+	rows, err := store.Rows("t", indices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, index := range indices {
+		if got, want := rows[i]["n"], int64(ids[index]); got != want {
+			t.Errorf("row %d: n = %v, want %v", index, got, want)
+		}
+	}
+
+	if _, err := store.Rows("t", []int{len(ids)}); err == nil {
+		t.Errorf("Rows beyond the table succeeded")
+	}
+}
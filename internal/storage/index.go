@@ -0,0 +1,359 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	indexInterval   = 64 // Entries of a run between two keys of its sparse index
+	bloomBitsPerKey = 10 // About 1% false positives with bloomHashes hashes
+	bloomHashes     = 7
+)
+
+// keyIndex maps row keys to row positions for one table. Keys are kept in
+// memory until there are spillAt of them, then written to a run file sorted by
+// key. Each run keeps a bloom filter and a sparse index of every
+// indexInterval-th key in memory, so a lookup reads at most one small block of
+// the runs that may hold the key. A run is merged into the previous one once it
+// is at least half its size, which keeps O(log n) runs: lookup cost stays flat
+// as the index grows.
+type keyIndex struct {
+	prefix  string // Run files are named prefix-<n>
+	spillAt int
+	memory  map[string]int
+	runs    []*keyRun // Oldest and largest first
+	files   int       // Run files created so far, used to name new ones
+}
+
+// keyRun is a file of key entries sorted by key. Keys are unique across the
+// runs of an index.
+type keyRun struct {
+	file   *os.File
+	size   int64
+	count  int
+	bloom  bloomFilter
+	sparse []sparseEntry
+}
+
+// sparseEntry is the offset in a run file of the entry of key.
+type sparseEntry struct {
+	key    string
+	offset int64
+}
+
+func newKeyIndex(prefix string, spillAt int) *keyIndex {
+	return &keyIndex{
+		prefix:  prefix,
+		spillAt: spillAt,
+		memory:  make(map[string]int),
+	}
+}
+
+func (x *keyIndex) lookup(key string) (int, bool, error) {
+	if index, ok := x.memory[key]; ok {
+		return index, true, nil
+	}
+
+	for i := len(x.runs) - 1; i >= 0; i-- {
+		index, ok, err := x.runs[i].lookup(key)
+		if err != nil || ok {
+			return index, ok, err
+		}
+	}
+	return 0, false, nil
+}
+
+func (x *keyIndex) add(key string, index int) error {
+	x.memory[key] = index
+	if len(x.memory) < x.spillAt {
+		return nil
+	}
+	return x.spill()
+}
+
+// spill writes the keys held in memory to a new run, then merges runs.
+func (x *keyIndex) spill() error {
+	keys := make([]string, 0, len(x.memory))
+	for key := range x.memory {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w, err := x.newRunWriter(len(keys))
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := w.write(key, x.memory[key]); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	run, err := w.finish()
+	if err != nil {
+		return err
+	}
+
+	x.runs = append(x.runs, run)
+	x.memory = make(map[string]int)
+	return x.compact()
+}
+
+// compact merges the newest run into the previous one while it is at least
+// half its size, so run sizes decrease geometrically.
+func (x *keyIndex) compact() error {
+	for n := len(x.runs); n >= 2 && x.runs[n-1].count*2 >= x.runs[n-2].count; n = len(x.runs) {
+		merged, err := x.merge(x.runs[n-2], x.runs[n-1])
+		if err != nil {
+			return err
+		}
+		x.runs[n-2].remove()
+		x.runs[n-1].remove()
+		x.runs = append(x.runs[:n-2], merged)
+	}
+	return nil
+}
+
+// merge writes the entries of runs a and b to a new run, in key order.
+func (x *keyIndex) merge(a, b *keyRun) (*keyRun, error) {
+	w, err := x.newRunWriter(a.count + b.count)
+	if err != nil {
+		return nil, err
+	}
+
+	ra, rb := a.reader(), b.reader()
+	if err := ra.next(); err != nil {
+		w.abort()
+		return nil, err
+	}
+	if err := rb.next(); err != nil {
+		w.abort()
+		return nil, err
+	}
+
+	for ra.ok || rb.ok {
+		r := ra
+		if !ra.ok || (rb.ok && rb.key < ra.key) {
+			r = rb
+		}
+		if err := w.write(r.key, r.index); err != nil {
+			w.abort()
+			return nil, err
+		}
+		if err := r.next(); err != nil {
+			w.abort()
+			return nil, err
+		}
+	}
+
+	return w.finish()
+}
+
+// close closes the run files, which are removed with the store's directory.
+func (x *keyIndex) close() {
+	for _, run := range x.runs {
+		run.file.Close()
+	}
+	x.runs = nil
+	x.memory = nil
+}
+
+// lookup returns the position stored under key in the run. Only the block of
+// entries between the two sparse index keys around key is read.
+func (r *keyRun) lookup(key string) (int, bool, error) {
+	if !r.bloom.mayContain(key) {
+		return 0, false, nil
+	}
+
+	i := sort.Search(len(r.sparse), func(i int) bool { return r.sparse[i].key > key }) - 1
+	if i < 0 {
+		return 0, false, nil
+	}
+
+	end := r.size
+	if i+1 < len(r.sparse) {
+		end = r.sparse[i+1].offset
+	}
+
+	block := make([]byte, end-r.sparse[i].offset)
+	if _, err := r.file.ReadAt(block, r.sparse[i].offset); err != nil {
+		return 0, false, err
+	}
+
+	for len(block) > 0 {
+		entryKey, index, n := decodeEntry(block)
+		if n <= 0 {
+			return 0, false, fmt.Errorf("corrupt key index %s", r.file.Name())
+		}
+		switch {
+		case entryKey == key:
+			return index, true, nil
+		case entryKey > key:
+			return 0, false, nil
+		}
+		block = block[n:]
+	}
+	return 0, false, nil
+}
+
+// remove closes and deletes the run file.
+func (r *keyRun) remove() {
+	r.file.Close()
+	os.Remove(r.file.Name())
+}
+
+// reader returns a reader of the run's entries in key order.
+func (r *keyRun) reader() *runReader {
+	return &runReader{reader: bufio.NewReader(io.NewSectionReader(r.file, 0, r.size))}
+}
+
+// runReader reads the entries of a run in order. After next, ok reports
+// whether key and index hold an entry.
+type runReader struct {
+	reader *bufio.Reader
+	key    string
+	index  int
+	ok     bool
+}
+
+func (rr *runReader) next() error {
+	length, err := binary.ReadUvarint(rr.reader)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			rr.ok = false
+			return nil
+		}
+		return err
+	}
+
+	key := make([]byte, length)
+	if _, err := io.ReadFull(rr.reader, key); err != nil {
+		return err
+	}
+
+	index, err := binary.ReadUvarint(rr.reader)
+	if err != nil {
+		return err
+	}
+
+	rr.key, rr.index, rr.ok = string(key), int(index), true
+	return nil
+}
+
+// runWriter writes the entries of a new run in key order, building its bloom
+// filter and sparse index.
+type runWriter struct {
+	run    *keyRun
+	writer *bufio.Writer
+	entry  []byte
+}
+
+// newRunWriter creates the file of a new run that will hold count keys.
+func (x *keyIndex) newRunWriter(count int) (*runWriter, error) {
+	x.files++
+	file, err := os.OpenFile(fmt.Sprintf("%s-%d", x.prefix, x.files), os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &runWriter{
+		run:    &keyRun{file: file, bloom: newBloomFilter(count)},
+		writer: bufio.NewWriter(file),
+	}, nil
+}
+
+func (w *runWriter) write(key string, index int) error {
+	r := w.run
+	if r.count%indexInterval == 0 {
+		r.sparse = append(r.sparse, sparseEntry{key: key, offset: r.size})
+	}
+	r.bloom.add(key)
+
+	w.entry = binary.AppendUvarint(w.entry[:0], uint64(len(key)))
+	w.entry = append(w.entry, key...)
+	w.entry = binary.AppendUvarint(w.entry, uint64(index))
+
+	n, err := w.writer.Write(w.entry)
+	r.size += int64(n)
+	r.count++
+	return err
+}
+
+// finish flushes the run file, which stays open for lookups.
+func (w *runWriter) finish() (*keyRun, error) {
+	if err := w.writer.Flush(); err != nil {
+		w.abort()
+		return nil, err
+	}
+	return w.run, nil
+}
+
+func (w *runWriter) abort() {
+	w.run.remove()
+}
+
+// decodeEntry decodes the entry at the start of block and returns its length,
+// or 0 if block does not start with a whole entry.
+func decodeEntry(block []byte) (string, int, int) {
+	length, n := binary.Uvarint(block)
+	if n <= 0 || uint64(len(block)-n) < length {
+		return "", 0, 0
+	}
+	key := string(block[n : n+int(length)])
+	n += int(length)
+
+	index, m := binary.Uvarint(block[n:])
+	if m <= 0 {
+		return "", 0, 0
+	}
+	return key, int(index), n + m
+}
+
+// bloomFilter is a bit set telling keys that are certainly not in a run from
+// those that may be.
+type bloomFilter []uint64
+
+// bloomSeed seeds the hashes of every bloom filter; filters are never
+// persisted, so a per-process seed is enough.
+var bloomSeed = maphash.MakeSeed()
+
+func newBloomFilter(keys int) bloomFilter {
+	bits := max(keys*bloomBitsPerKey, 64)
+	return make(bloomFilter, (bits+63)/64)
+}
+
+// positions returns the bits of key, derived from one 64-bit hash by double
+// hashing.
+func (f bloomFilter) positions(key string) [bloomHashes]uint64 {
+	sum := maphash.String(bloomSeed, key)
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	m := uint64(len(f)) * 64
+
+	var bits [bloomHashes]uint64
+	for i := range bits {
+		bits[i] = (h1 + uint64(i)*h2) % m
+	}
+	return bits
+}
+
+func (f bloomFilter) add(key string) {
+	for _, bit := range f.positions(key) {
+		f[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f bloomFilter) mayContain(key string) bool {
+	for _, bit := range f.positions(key) {
+		if f[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyIndexLookup(t *testing.T) {
+	x := newKeyIndex(filepath.Join(t.TempDir(), "index"), 10)
+	defer x.close()
+
+	const keys = 1000
+	for i := 0; i < keys; i++ {
+		if err := x.add(fmt.Sprintf("key-%d", i), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(x.runs) > 10 {
+		t.Errorf("%d runs for %d keys, want O(log n)", len(x.runs), keys)
+	}
+
+	for i := 0; i < keys; i++ {
+		index, ok, err := x.lookup(fmt.Sprintf("key-%d", i))
+		if err != nil || !ok || index != i {
+			t.Fatalf("lookup(key-%d) = %d, %v, %v", i, index, ok, err)
+		}
+	}
+
+	for _, key := range []string{"", "key-", "key-1000", "zzz"} {
+		if _, ok, err := x.lookup(key); ok || err != nil {
+			t.Errorf("lookup(%q) = %v, %v; want false, nil", key, ok, err)
+		}
+	}
+}
+
+// BenchmarkKeyIndexLookup looks up keys, half of them absent, in indexes of
+// increasing size; the time per lookup should not grow with the size.
+func BenchmarkKeyIndexLookup(b *testing.B) {
+	for _, size := range []int{10_000, 100_000, 1_000_000} {
+		b.Run(fmt.Sprintf("keys=%d", size), func(b *testing.B) {
+			x := newKeyIndex(filepath.Join(b.TempDir(), "index"), DefaultSegmentRows)
+			defer x.close()
+
+			for i := 0; i < size; i++ {
+				if err := x.add(fmt.Sprintf("key-%d", i), i); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := x.lookup(fmt.Sprintf("key-%d", (i*7919)%(2*size))); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
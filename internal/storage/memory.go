@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MemoryStore keeps all rows and keys in memory.
+type MemoryStore struct {
+	keyColumns KeyColumns
+	rows       map[string][]map[string]interface{}
+	keys       map[string]map[string]int
+}
+
+// NewMemoryStore creates an empty in-memory store whose Sorted orders rows by
+// keyColumns.
+func NewMemoryStore(keyColumns KeyColumns) *MemoryStore {
+	return &MemoryStore{
+		keyColumns: keyColumns,
+		rows:       make(map[string][]map[string]interface{}),
+		keys:       make(map[string]map[string]int),
+	}
+}
+
+func (s *MemoryStore) Lookup(table, key string) (int, bool, error) {
+	index, ok := s.keys[table][key]
+	return index, ok, nil
+}
+
+func (s *MemoryStore) Add(table, key string, row map[string]interface{}) (int, error) {
+	if s.keys[table] == nil {
+		s.keys[table] = make(map[string]int)
+	}
+
+	index := len(s.rows[table])
+	s.keys[table][key] = index
+	s.rows[table] = append(s.rows[table], row)
+	return index, nil
+}
+
+func (s *MemoryStore) Len(table string) int {
+	return len(s.rows[table])
+}
+
+func (s *MemoryStore) Tables() []string {
+	tables := make([]string, 0, len(s.rows))
+	for table := range s.rows {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+func (s *MemoryStore) Rows(table string, indices []int) ([]map[string]interface{}, error) {
+	stored := s.rows[table]
+	rows := make([]map[string]interface{}, len(indices))
+	for i, index := range indices {
+		if index < 0 || index >= len(stored) {
+			return nil, fmt.Errorf("row %d of %s does not exist", index, table)
+		}
+		rows[i] = stored[index]
+	}
+	return rows, nil
+}
+
+func (s *MemoryStore) Sorted(table string) (RowIterator, error) {
+	rows := make([]map[string]interface{}, len(s.rows[table]))
+	copy(rows, s.rows[table])
+
+	keyColumns := s.keyColumns(table)
+	sort.SliceStable(rows, func(i, j int) bool {
+		return Less(rows[i], rows[j], keyColumns)
+	})
+
+	return &sliceIterator{rows: rows}, nil
+}
+
+func (s *MemoryStore) Close() error {
+	s.rows = nil
+	s.keys = nil
+	return nil
+}
@@ -0,0 +1,102 @@
+// Package storage holds the rows collected during an extraction. Rows are
+// stored per table in the order they are added, deduplicated by a key string,
+// and can be read back by position or streamed in row key order. MemoryStore
+// keeps everything in memory; DiskStore spills rows and keys to files so that
+// extractions larger than memory can complete.
+package storage
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Store holds the extracted rows of every table. Implementations are not safe
+// for concurrent use.
+type Store interface {
+	// Lookup returns the position of the row stored under key in table.
+	Lookup(table, key string) (int, bool, error)
+
+	// Add stores row under key, which must not be stored yet, and returns
+	// the row's position in table.
+	Add(table, key string, row map[string]interface{}) (int, error)
+
+	// Len returns the number of rows stored in table.
+	Len(table string) int
+
+	// Tables returns the tables with at least one row, in name order.
+	Tables() []string
+
+	// Rows returns the rows of table at the given positions, in that order.
+	Rows(table string, indices []int) ([]map[string]interface{}, error)
+
+	// Sorted streams the rows of table ordered by row key (see Less), rows
+	// with equal keys in the order they were added.
+	Sorted(table string) (RowIterator, error)
+
+	// Close releases the store's resources, including any files.
+	Close() error
+}
+
+// RowIterator streams rows. Call Next until it returns false, then check Err.
+// Close must be called if iteration stops early.
+type RowIterator interface {
+	Next() bool
+	Row() map[string]interface{}
+	Err() error
+	Close() error
+}
+
+// KeyColumns returns the columns rows of a table are ordered by: its primary
+// key or a NOT NULL unique key, or none for keyless tables.
+type KeyColumns func(table string) []string
+
+// Less reports whether row a sorts before row b by the given key columns,
+// comparing the text form of each value. Rows of keyless tables (empty
+// keyColumns) are compared on all their columns in name order.
+func Less(a, b map[string]interface{}, keyColumns []string) bool {
+	if len(keyColumns) == 0 {
+		keyColumns = unionColumns(a, b)
+	}
+
+	for _, col := range keyColumns {
+		va := fmt.Sprintf("%v", a[col])
+		vb := fmt.Sprintf("%v", b[col])
+		if va != vb {
+			return va < vb
+		}
+	}
+	return false
+}
+
+// unionColumns returns the columns of a and b in name order.
+func unionColumns(a, b map[string]interface{}) []string {
+	columns := make([]string, 0, len(a))
+	for col := range a {
+		columns = append(columns, col)
+	}
+	for col := range b {
+		if _, ok := a[col]; !ok {
+			columns = append(columns, col)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// sliceIterator iterates over rows held in memory.
+type sliceIterator struct {
+	rows []map[string]interface{}
+	next int
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.next >= len(it.rows) {
+		return false
+	}
+	it.next++
+	return true
+}
+
+func (it *sliceIterator) Row() map[string]interface{} { return it.rows[it.next-1] }
+func (it *sliceIterator) Err() error                  { return nil }
+func (it *sliceIterator) Close() error                { return nil }
@@ -52,6 +52,23 @@ echo -e "\n${GREEN}Test 7: Dry run${NC}"
 echo -e "\n${GREEN}Test 8: Row limit (should work with small dataset)${NC}"
 ./pg_rocket pull --query "SELECT * FROM tasks" --max-rows 20 --out test/fixtures/test5_limit.sql --verbose
 
+# Test 9: Foreign key cycles, replayed into an empty copy of the schema
+echo -e "\n${GREEN}Test 9: Foreign key cycles (deferred and postponed)${NC}"
+./pg_rocket pull --query "SELECT * FROM departments WHERE id = 1" --query "SELECT * FROM teams WHERE id = 1" --out test/fixtures/test6_cycles.sql --verbose
+grep -q "SET CONSTRAINTS ALL DEFERRED" test/fixtures/test6_cycles.sql
+grep -q "^UPDATE .*teams.* SET lead_id = 1" test/fixtures/test6_cycles.sql
+cd test/integration
+docker-compose exec -T postgres createdb -U testuser cycles_target
+docker-compose exec -T postgres sh -c "pg_dump -U testuser --schema-only -t departments -t employees -t teams -t team_members testdb | psql -q -v ON_ERROR_STOP=1 -U testuser -d cycles_target"
+docker-compose exec -T postgres psql -q -v ON_ERROR_STOP=1 -U testuser -d cycles_target < ../fixtures/test6_cycles.sql
+cd ../..
+
+# Test 10: Schemas reached through another cross-schema foreign key
+echo -e "\n${GREEN}Test 10: Cross-schema chain (sales -> billing -> auth)${NC}"
+./pg_rocket pull --schemas sales --query "SELECT * FROM orders WHERE id = 1" --parents --out test/fixtures/test7_schemas.sql --verbose
+grep -q 'INSERT INTO "billing"."accounts"' test/fixtures/test7_schemas.sql
+grep -q 'INSERT INTO "auth"."users"' test/fixtures/test7_schemas.sql
+
 # Cleanup
 echo -e "\n${GREEN}Cleaning up...${NC}"
 cd test/integration
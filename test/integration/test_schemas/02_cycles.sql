@@ -0,0 +1,65 @@
+-- Foreign key cycles: departments <-> employees is broken by a DEFERRABLE
+-- constraint, teams <-> team_members by a nullable column
+CREATE TABLE departments (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    head_id INTEGER NOT NULL
+);
+
+CREATE TABLE employees (
+    id SERIAL PRIMARY KEY,
+    department_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    FOREIGN KEY (department_id) REFERENCES departments(id)
+);
+
+ALTER TABLE departments
+    ADD FOREIGN KEY (head_id) REFERENCES employees(id) DEFERRABLE INITIALLY IMMEDIATE;
+
+CREATE TABLE teams (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    lead_id INTEGER
+);
+
+CREATE TABLE team_members (
+    id SERIAL PRIMARY KEY,
+    team_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    FOREIGN KEY (team_id) REFERENCES teams(id)
+);
+
+ALTER TABLE teams
+    ADD FOREIGN KEY (lead_id) REFERENCES team_members(id);
+
+-- Insert test data
+BEGIN;
+SET CONSTRAINTS ALL DEFERRED;
+
+INSERT INTO departments (id, name, head_id) VALUES
+    (1, 'Engineering', 1),
+    (2, 'Sales', 3);
+
+INSERT INTO employees (id, department_id, name) VALUES
+    (1, 1, 'Dana Director'),
+    (2, 1, 'Eve Engineer'),
+    (3, 2, 'Sam Seller');
+
+COMMIT;
+
+INSERT INTO teams (id, name, lead_id) VALUES
+    (1, 'Platform', NULL),
+    (2, 'Growth', NULL);
+
+INSERT INTO team_members (id, team_id, name) VALUES
+    (1, 1, 'Pat Platform'),
+    (2, 1, 'Lee Platform'),
+    (3, 2, 'Gus Growth');
+
+UPDATE teams SET lead_id = 1 WHERE id = 1;
+UPDATE teams SET lead_id = 3 WHERE id = 2;
+
+SELECT setval('departments_id_seq', 2);
+SELECT setval('employees_id_seq', 3);
+SELECT setval('teams_id_seq', 2);
+SELECT setval('team_members_id_seq', 3);
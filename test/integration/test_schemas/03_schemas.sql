@@ -0,0 +1,26 @@
+-- Cross-schema chain: sales.orders -> billing.accounts -> auth.users, where
+-- auth is reached only through billing
+CREATE SCHEMA auth;
+CREATE SCHEMA billing;
+CREATE SCHEMA sales;
+
+CREATE TABLE auth.users (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL
+);
+
+CREATE TABLE billing.accounts (
+    id SERIAL PRIMARY KEY,
+    owner_id INTEGER NOT NULL REFERENCES auth.users(id),
+    plan VARCHAR(50) NOT NULL
+);
+
+CREATE TABLE sales.orders (
+    id SERIAL PRIMARY KEY,
+    account_id INTEGER NOT NULL REFERENCES billing.accounts(id),
+    total NUMERIC(10, 2) NOT NULL
+);
+
+INSERT INTO auth.users (id, email) VALUES (1, 'owner@example.com');
+INSERT INTO billing.accounts (id, owner_id, plan) VALUES (1, 1, 'pro');
+INSERT INTO sales.orders (id, account_id, total) VALUES (1, 1, 99.00);